@@ -0,0 +1,263 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// alertCmd predicts signatures expiring before they are replaced
+var alertCmd = &cobra.Command{
+	Use:     "alert [--tld <name>] [--rr <type>[,<type>...]]",
+	Version: "0.0.1a",
+	Short:   "alert on signatures expiring before they are replaced",
+	Long: `alert on signatures expiring before they are replaced
+
+For every RR set signed by a TLD the signature with the latest expiration of
+the last day it was observed is checked. The next re-sign is predicted from
+the inception and the median re-sign interval of the RR set, or of all RR sets
+of the same type of the TLD if the RR set was not re-signed during the
+measurement (see cadence). Denial proofs are not checked, a random name hits
+another proof with every query.
+
+Alerts are
+  expired                the signature has expired
+  expires-before-resign  the signature expires before the predicted re-sign
+  below-soa-expire       the remaining lifetime is shorter than SOA expire
+  below-dnskey-ttl       the remaining lifetime is shorter than the DNSKEY TTL
+
+Every RR set with alerts is written as one JSON object per line, the
+remaining lifetime is counted from now in seconds.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		alertRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(alertCmd)
+
+	// define command line arguments
+	addRunFlags(alertCmd)
+	addAllOwnersFlag(alertCmd)
+}
+
+// alerts raised by alert
+const (
+	ALERT_EXPIRED       = "expired"
+	ALERT_BEFORE_RESIGN = "expires-before-resign"
+	ALERT_SOA_EXPIRE    = "below-soa-expire"
+	ALERT_DNSKEY_TTL    = "below-dnskey-ttl"
+)
+
+// signatureAlert is the JSON object written for every RR set with alerts
+type signatureAlert struct {
+	Alerts     []string   `json:"alerts"`
+	TLD        string     `json:"tld"`
+	Owner      string     `json:"owner,omitempty"`
+	RRType     string     `json:"rrtype"`
+	KeyTag     uint16     `json:"keytag"`
+	Observed   time.Time  `json:"observed"`
+	Server     string     `json:"server,omitempty"`
+	Inception  time.Time  `json:"inception"`
+	Expiration time.Time  `json:"expiration"`
+	Remaining  int64      `json:"remaining"`
+	Resign     int64      `json:"resign_interval,omitempty"`
+	NextResign *time.Time `json:"next_resign,omitempty"`
+	SOAExpire  uint32     `json:"soa_expire,omitempty"`
+	DNSKEYTTL  uint32     `json:"dnskey_ttl,omitempty"`
+	Message    string     `json:"message"`
+}
+
+// alertKey identifies a signed RR set
+type alertKey struct {
+	tld    string
+	owner  string
+	rrtype uint16
+}
+
+func alertRun(args []string) {
+
+	// check TLD command line argument, check all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, check all types if not given
+	filter.RRTypes = getRRTypes(false)
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+	filter.AllOwners = viper.GetBool(ALL_OWNERS)
+
+	//
+	// SOA expire and DNSKEY TTL of the last observation
+	//
+	soaData, err := store.SOAs(storage.Filter{TLD: filter.TLD, Runs: filter.Runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var soaExpire map[string]uint32 = make(map[string]uint32, 0)
+	for _, soa := range soaData {
+		soaExpire[soa.TLD] = soa.Record.Expire
+	}
+
+	keySigs, err := store.Signatures(storage.Filter{TLD: filter.TLD, RRType: dns.TypeDNSKEY, Runs: filter.Runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var dnskeyTTL map[string]uint32 = make(map[string]uint32, 0)
+	for _, sig := range keySigs {
+		if sig.Owner == "" && sig.OrigTTL > 0 {
+			dnskeyTTL[sig.TLD] = sig.OrigTTL
+		}
+	}
+
+	//
+	// re-sign history
+	//
+	sigData, err := store.Signatures(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var resignByRRSet map[alertKey][]int64 = make(map[alertKey][]int64, 0)
+	var resignByType map[alertKey][]int64 = make(map[alertKey][]int64, 0)
+	for series, signatures := range distinctSignatures(sigData) {
+		if series.proof {
+			continue
+		}
+		intervals := resignIntervals(signatures)
+		key := alertKey{tld: series.tld, owner: series.owner, rrtype: series.rrtype}
+		resignByRRSet[key] = append(resignByRRSet[key], intervals...)
+		typeKey := alertKey{tld: series.tld, rrtype: series.rrtype}
+		resignByType[typeKey] = append(resignByType[typeKey], intervals...)
+	}
+
+	// signature with the latest expiration of the last day every RR set was observed,
+	// denial proofs are replaced by others with every query and never re-signed
+	var current map[alertKey]storage.Signature = make(map[alertKey]storage.Signature, 0)
+	for _, sig := range sigData {
+		if sig.Proof || sig.RRType == dns.TypeDS || (sig.SignerName != "" && !strings.EqualFold(sig.SignerName, sig.TLD)) {
+			continue
+		}
+		key := alertKey{tld: sig.TLD, owner: sig.Owner, rrtype: sig.RRType}
+		last, ok := current[key]
+		day, lastDay := normalizeDay(sig.Resolved.UTC()), normalizeDay(last.Resolved.UTC())
+		if !ok || day.After(lastDay) || (day.Equal(lastDay) && sig.Expiration.After(last.Expiration)) {
+			current[key] = sig
+		}
+	}
+
+	var keys []alertKey
+	for key := range current {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tld != keys[j].tld {
+			return keys[i].tld < keys[j].tld
+		}
+		if keys[i].owner != keys[j].owner {
+			return keys[i].owner < keys[j].owner
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+
+	now := time.Now().UTC()
+	encoder := json.NewEncoder(os.Stdout)
+	var count int
+	for _, key := range keys {
+		sig := current[key]
+		a := signatureAlert{
+			TLD:        sig.TLD,
+			Owner:      sig.Owner,
+			RRType:     dns.TypeToString[sig.RRType],
+			KeyTag:     sig.KeyTag,
+			Observed:   sig.Resolved.UTC(),
+			Server:     sig.Server,
+			Inception:  sig.Inception.UTC(),
+			Expiration: sig.Expiration.UTC(),
+			Remaining:  int64(sig.Expiration.Sub(now) / time.Second),
+			SOAExpire:  soaExpire[sig.TLD],
+			DNSKEYTTL:  dnskeyTTL[sig.TLD],
+		}
+		var messages []string
+
+		if a.Remaining <= 0 {
+			a.Alerts = append(a.Alerts, ALERT_EXPIRED)
+			messages = append(messages, fmt.Sprintf("expired %s ago", days2str(-a.Remaining)))
+		}
+
+		intervals := resignByRRSet[key]
+		if len(intervals) == 0 {
+			intervals = resignByType[alertKey{tld: key.tld, rrtype: key.rrtype}]
+		}
+		if len(intervals) > 0 {
+			a.Resign = median(intervals)
+			next := a.Inception.Add(time.Duration(a.Resign) * time.Second)
+			a.NextResign = &next
+			if a.Expiration.Before(next) {
+				a.Alerts = append(a.Alerts, ALERT_BEFORE_RESIGN)
+				messages = append(messages, fmt.Sprintf("expires %s before the next re-sign", days2str(int64(next.Sub(a.Expiration)/time.Second))))
+			}
+		}
+
+		if a.Remaining > 0 && a.SOAExpire > 0 && a.Remaining < int64(a.SOAExpire) {
+			a.Alerts = append(a.Alerts, ALERT_SOA_EXPIRE)
+			messages = append(messages, fmt.Sprintf("remaining lifetime %s below SOA expire %s", days2str(a.Remaining), days2str(int64(a.SOAExpire))))
+		}
+		if a.Remaining > 0 && a.DNSKEYTTL > 0 && a.Remaining < int64(a.DNSKEYTTL) {
+			a.Alerts = append(a.Alerts, ALERT_DNSKEY_TTL)
+			messages = append(messages, fmt.Sprintf("remaining lifetime %s below DNSKEY TTL %s", days2str(a.Remaining), days2str(int64(a.DNSKEYTTL))))
+		}
+
+		if len(a.Alerts) == 0 {
+			continue
+		}
+		a.Message = strings.Join(messages, ", ")
+		if err := encoder.Encode(a); err != nil {
+			log.Fatal(err.Error())
+		}
+		count++
+	}
+	log.Infof("%d of %d RR sets with alerts", count, len(keys))
+}
@@ -0,0 +1,271 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+	"github.com/ulrichwisser/dnssectiming/tldclass"
+)
+
+// cadenceCmd infers the signing policy of every TLD
+var cadenceCmd = &cobra.Command{
+	Use:     "cadence [--tld <name>] [--rr <type>[,<type>...]] [--group-by <attribute>]",
+	Version: "0.0.1a",
+	Short:   "infer how often every TLD re-signs",
+	Long: `infer how often every TLD re-signs
+
+Every distinct RRSIG made by the TLD (same owner, type, key tag, inception and
+expiration) is one signature. Signatures of DS records are made by the parent
+and are not used. Signatures of denial proofs are used for validity, jitter and
+inception but not for re-sign intervals.
+
+resign      median time between the inceptions of consecutive signatures of an RR set
+validity    median time between inception and expiration
+jitter      largest deviation of a validity period from the median of its RR type
+inception   shortest time between inception and the first observation of a signature,
+            an upper bound of the backdating of the inception
+
+Observations are made once a day, shorter re-sign intervals can not be seen.
+All times are in seconds, the last column is a readable profile.
+With --group-by the lines are made per value of a TLD attribute instead of per TLD.
+
+Every RR type has its own profile, keys are often signed with another validity
+and cadence than the zone data.
+
+Output columns: tld type signatures resign validity jitter inception profile`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		cadenceRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(cadenceCmd)
+
+	// define command line arguments
+	addRunFlags(cadenceCmd)
+	addAllOwnersFlag(cadenceCmd)
+	addGroupFlags(cadenceCmd)
+}
+
+// cadenceSeries identifies the signatures of one RR set made with one key.
+// Denial proofs are seen by chance, when a random name falls into their range.
+// The time between two of them is no re-sign interval.
+type cadenceSeries struct {
+	tld    string
+	owner  string
+	rrtype uint16
+	keytag uint16
+	proof  bool
+}
+
+// cadenceSignature is one distinct signature
+type cadenceSignature struct {
+	inception  time.Time
+	expiration time.Time
+}
+
+// cadenceKey identifies one line of the cadence report
+type cadenceKey struct {
+	tld    string
+	rrtype uint16
+}
+
+func cadenceRun(args []string) {
+
+	// check TLD command line argument, report all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, use all types if not given
+	filter.RRTypes = getRRTypes(false)
+
+	// check classification command line arguments, every TLD if not given
+	groups := getGroups(tldclass.AttrTLD)
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+	filter.AllOwners = viper.GetBool(ALL_OWNERS)
+
+	sigData, err := store.Signatures(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	firstSeen := distinctSignatures(sigData)
+
+	// collect intervals per line of the report, validity per TLD and type for the jitter
+	type cadenceStats struct {
+		signatures int
+		resign     []int64
+		validity   []int64
+		inception  int64
+		jitter     int64
+	}
+	var stats map[cadenceKey]*cadenceStats = make(map[cadenceKey]*cadenceStats, 0)
+	var validityByType map[cadenceKey][]int64 = make(map[cadenceKey][]int64, 0)
+	for series, signatures := range firstSeen {
+		key := cadenceKey{tld: groups.of(series.tld), rrtype: series.rrtype}
+		if _, ok := stats[key]; !ok {
+			stats[key] = &cadenceStats{inception: -1}
+		}
+		s := stats[key]
+
+		if !series.proof {
+			s.resign = append(s.resign, resignIntervals(signatures)...)
+		}
+		for signature := range signatures {
+			s.signatures++
+			validity := int64(signature.expiration.Sub(signature.inception) / time.Second)
+			s.validity = append(s.validity, validity)
+			typeKey := cadenceKey{tld: series.tld, rrtype: series.rrtype}
+			validityByType[typeKey] = append(validityByType[typeKey], validity)
+			if offset := int64(signatures[signature].Sub(signature.inception) / time.Second); s.inception < 0 || offset < s.inception {
+				s.inception = offset
+			}
+		}
+	}
+
+	// jitter of the validity period per RR type
+	for typeKey, validities := range validityByType {
+		key := cadenceKey{tld: groups.of(typeKey.tld), rrtype: typeKey.rrtype}
+		med := median(validities)
+		for _, validity := range validities {
+			deviation := validity - med
+			if deviation < 0 {
+				deviation = -deviation
+			}
+			if deviation > stats[key].jitter {
+				stats[key].jitter = deviation
+			}
+		}
+	}
+
+	var keys []cadenceKey
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tld != keys[j].tld {
+			return keys[i].tld < keys[j].tld
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+
+	fmt.Printf("# %s type signatures resign validity jitter inception profile\n", groups.attribute)
+	for _, key := range keys {
+		s := stats[key]
+		resign := "NaN"
+		profile := "re-signs not seen"
+		if len(s.resign) > 0 {
+			resign = fmt.Sprintf("%d", median(s.resign))
+			profile = "re-signs every " + days2str(median(s.resign))
+		}
+		profile += fmt.Sprintf(", validity %s, jitter ±%s, inception -%s", days2str(median(s.validity)), days2str(s.jitter), days2str(s.inception))
+		fmt.Printf("%s %s %d %s %d %d %d %q\n", key.tld, dns.TypeToString[key.rrtype], s.signatures, resign, median(s.validity), s.jitter, s.inception, profile)
+	}
+}
+
+// distinctSignatures returns the first observation of every distinct signature made by the TLD
+func distinctSignatures(sigData []storage.Signature) map[cadenceSeries]map[cadenceSignature]time.Time {
+	var firstSeen map[cadenceSeries]map[cadenceSignature]time.Time = make(map[cadenceSeries]map[cadenceSignature]time.Time, 0)
+	for _, sig := range sigData {
+		// signatures stored before schema version 2 have no signer
+		if sig.RRType == dns.TypeDS || (sig.SignerName != "" && !strings.EqualFold(sig.SignerName, sig.TLD)) {
+			continue
+		}
+		series := cadenceSeries{tld: sig.TLD, owner: sig.Owner, rrtype: sig.RRType, keytag: sig.KeyTag, proof: sig.Proof}
+		if _, ok := firstSeen[series]; !ok {
+			firstSeen[series] = make(map[cadenceSignature]time.Time, 0)
+		}
+		signature := cadenceSignature{inception: sig.Inception.UTC(), expiration: sig.Expiration.UTC()}
+		if seen, ok := firstSeen[series][signature]; !ok || sig.Resolved.Before(seen) {
+			firstSeen[series][signature] = sig.Resolved.UTC()
+		}
+	}
+	return firstSeen
+}
+
+// resignIntervals returns the seconds between the inceptions of consecutive signatures
+func resignIntervals(signatures map[cadenceSignature]time.Time) []int64 {
+	var inceptions []time.Time
+	for signature := range signatures {
+		inceptions = append(inceptions, signature.inception)
+	}
+	sort.Slice(inceptions, func(i, j int) bool { return inceptions[i].Before(inceptions[j]) })
+
+	var intervals []int64
+	for i := 1; i < len(inceptions); i++ {
+		if inceptions[i].After(inceptions[i-1]) {
+			intervals = append(intervals, int64(inceptions[i].Sub(inceptions[i-1])/time.Second))
+		}
+	}
+	return intervals
+}
+
+// median of a list of intervals, the list is sorted
+func median(values []int64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	if len(values)%2 == 0 {
+		return (values[len(values)/2-1] + values[len(values)/2]) / 2
+	}
+	return values[len(values)/2]
+}
+
+// days2str formats an interval in days or hours with one decimal, like 3.5d or 1h
+func days2str(seconds int64) string {
+	var value float64
+	var unit string
+	switch {
+	case seconds >= 86400:
+		value, unit = float64(seconds)/86400, "d"
+	case seconds >= 3600:
+		value, unit = float64(seconds)/3600, "h"
+	case seconds >= 60:
+		value, unit = float64(seconds)/60, "m"
+	default:
+		value, unit = float64(seconds), "s"
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + unit
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/tldclass"
+)
+
+// tldGroups assigns every TLD to a group by one attribute of the TLD classification
+type tldGroups struct {
+	registry  *tldclass.Registry
+	attribute string
+}
+
+// addGroupFlags adds the TLD classification command line arguments to a report
+func addGroupFlags(cmd *cobra.Command) {
+	cmd.Flags().String(ROOTDB, "", ROOTDB_DESCRIPTION)
+	cmd.Flags().StringArray(TLD_LIST, []string{}, TLD_LIST_DESCRIPTION)
+	cmd.Flags().String(GROUP_BY, "", GROUP_BY_DESCRIPTION)
+}
+
+// getGroups loads the TLD classification from the root zone database and
+// the TLD lists and checks the group-by command line argument.
+// Reports use defaultAttribute if no attribute was given.
+func getGroups(defaultAttribute string) tldGroups {
+	registry := tldclass.New()
+	if filename := viper.GetString(ROOTDB); filename != "" {
+		if err := registry.LoadRootDB(filename); err != nil {
+			log.Fatalf("Could not read root zone database %s", err)
+		}
+	}
+	for _, list := range viper.GetStringSlice(TLD_LIST) {
+		parts := strings.SplitN(list, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Fatalf("TLD list %s must be given as <attribute>=<file>", list)
+		}
+		if err := registry.LoadList(parts[0], parts[1]); err != nil {
+			log.Fatalf("Could not read TLD list %s", err)
+		}
+	}
+
+	attribute := strings.ToLower(strings.TrimSpace(viper.GetString(GROUP_BY)))
+	if attribute == "" {
+		attribute = defaultAttribute
+	}
+	if !registry.HasAttribute(attribute) {
+		log.Fatalf("Unknown attribute %s. Must be one of %s", attribute, strings.Join(registry.Attributes(), ", "))
+	}
+	log.Debugf("group TLD by %s", attribute)
+	return tldGroups{registry: registry, attribute: attribute}
+}
+
+// of returns the group of a TLD, spaces are replaced so the group is one output column
+func (g tldGroups) of(tld string) string {
+	return strings.ReplaceAll(g.registry.Value(tld, g.attribute), " ", "_")
+}
+
+// values returns the sorted groups of a list of TLD
+func (g tldGroups) values(tlds []string) []string {
+	var values []string
+	for _, value := range g.registry.Values(g.attribute, tlds) {
+		values = append(values, strings.ReplaceAll(value, " ", "_"))
+	}
+	return values
+}
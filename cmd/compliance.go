@@ -0,0 +1,349 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+	"github.com/ulrichwisser/dnssectiming/tldclass"
+)
+
+// checks of the compliance scorecard
+const (
+	CHECK_VALIDITY_EXPIRE    = "validity-expire"
+	CHECK_RESIGN_VALIDITY    = "resign-validity"
+	CHECK_INCEPTION_SKEW     = "inception-skew"
+	CHECK_TTL_VALIDITY       = "ttl-validity"
+	CHECK_CHAIN_OF_TRUST     = "chain-of-trust"
+	CHECK_ZSK_ROLLOVER       = "zsk-rollover"
+	CHECK_KSK_ROLLOVER       = "ksk-rollover"
+	CHECK_ALGORITHM_ROLLOVER = "algorithm-rollover"
+)
+
+// RFC sections the checks are based on
+const (
+	CITE_TIME_CONSIDERATIONS = "RFC6781-4.4.2"
+	CITE_CHAIN_OF_TRUST      = "RFC4035-5.2"
+	CITE_ZSK_ROLLOVER        = "RFC7583-3.2"
+	CITE_KSK_ROLLOVER        = "RFC7583-3.3"
+	CITE_DOUBLE_KSK          = "RFC7583-3.3.1"
+	CITE_DOUBLE_DS           = "RFC7583-3.3.2"
+	CITE_ALGORITHM_ROLLOVER  = "RFC6781-4.1.4"
+)
+
+// results of a check
+const (
+	STATUS_PASS = "pass"
+	STATUS_WARN = "warn"
+	STATUS_FAIL = "fail"
+	STATUS_NA   = "n/a"
+)
+
+// inceptions should be backdated at least this much for validators with clock skew
+const INCEPTION_SKEW_MIN int64 = 3600
+
+// complianceResult is one line of the scorecard
+type complianceResult struct {
+	check    string
+	status   string
+	citation string
+	detail   string
+}
+
+// complianceData is what is known about the signing of one TLD
+type complianceData struct {
+	soaExpire int64
+	validity  []int64
+	resign    []int64
+	inception int64 // shortest time between inception and first observation
+	signed    bool  // signatures were seen
+	maxTTL    int64
+	samples   int
+	failures  map[string]int // samples failing rules of the failure model
+	rollovers map[string]int // rollovers per check
+	events    []rolloverEvent
+	chained   bool // DS and signed DNSKEY set were seen on at least one day
+}
+
+// scorecardRun prints the compliance scorecard of every TLD
+func scorecardRun() {
+
+	// check TLD command line argument, report all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, use all types if not given
+	filter.RRTypes = getRRTypes(false)
+
+	// check select command line argument
+	sel := getSelect()
+
+	// check failure model command line arguments
+	model := getFailureModel()
+
+	// check classification command line arguments, summary of all TLD if not given
+	groups := getGroups(tldclass.AttrTLD)
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+	filter.AllOwners = viper.GetBool(ALL_OWNERS)
+
+	var data map[string]*complianceData = make(map[string]*complianceData, 0)
+	dataOf := func(tld string) *complianceData {
+		if _, ok := data[tld]; !ok {
+			data[tld] = &complianceData{failures: make(map[string]int, 0), rollovers: make(map[string]int, 0)}
+		}
+		return data[tld]
+	}
+
+	//
+	// SOA of every probe, the last SOA expire of every TLD
+	//
+	soaData, err := store.SOAs(storage.Filter{TLD: filter.TLD, Runs: filter.Runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	soaByProbe := newSOAIndex(soaData)
+	var soaExpire map[string]int64 = make(map[string]int64, 0)
+	for _, soa := range soaData {
+		soaExpire[soa.TLD] = int64(soa.Record.Expire)
+	}
+
+	//
+	// signing cadence
+	//
+	sigData, err := store.Signatures(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for series, signatures := range distinctSignatures(sigData) {
+		d := dataOf(series.tld)
+		if !series.proof {
+			d.resign = append(d.resign, resignIntervals(signatures)...)
+		}
+		for signature, seen := range signatures {
+			d.validity = append(d.validity, int64(signature.expiration.Sub(signature.inception)/time.Second))
+			if offset := int64(seen.Sub(signature.inception) / time.Second); !d.signed || offset < d.inception {
+				d.inception = offset
+			}
+			d.signed = true
+		}
+	}
+
+	//
+	// TTL and failure model
+	//
+	for _, sig := range selectSignatures(sigData, sel) {
+		if sig.RRType == dns.TypeDS || (sig.SignerName != "" && !strings.EqualFold(sig.SignerName, sig.TLD)) {
+			continue
+		}
+		d := dataOf(sig.TLD)
+		if int64(sig.OrigTTL) > d.maxTTL {
+			d.maxTTL = int64(sig.OrigTTL)
+		}
+		soa, ok := soaByProbe.of(sig)
+		if !ok {
+			continue
+		}
+		d.samples++
+		for _, rule := range model.failed(failureSample{Signature: sig, SOA: soa}) {
+			d.failures[rule]++
+		}
+	}
+
+	//
+	// key rollovers
+	//
+	// keys are followed through all types, whatever types the other checks use
+	events, chained := rolloverEvents(store, storage.Filter{TLD: filter.TLD, Runs: filter.Runs})
+	for tld := range chained {
+		if d, ok := data[tld]; ok {
+			d.chained = true
+		}
+	}
+	for _, e := range events {
+		d, ok := data[e.tld]
+		if !ok {
+			continue
+		}
+		switch e.event {
+		case ROLLOVER_VIOLATION:
+			d.events = append(d.events, e)
+		case ROLLOVER_ROLLOVER:
+			switch {
+			case strings.HasPrefix(e.detail, ROLLOVER_ALGORITHM):
+				d.rollovers[CHECK_ALGORITHM_ROLLOVER]++
+			case e.key.role() == ROLE_ZSK:
+				d.rollovers[CHECK_ZSK_ROLLOVER]++
+			default:
+				d.rollovers[CHECK_KSK_ROLLOVER]++
+			}
+		}
+	}
+
+	var tlds []string
+	for tld := range data {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+
+	// the summary is made per group if TLD are grouped
+	summaryOf := func(tld string) string {
+		if groups.attribute == tldclass.AttrTLD {
+			return ""
+		}
+		return groups.of(tld) + " "
+	}
+
+	var count map[string]map[string]map[string]int = make(map[string]map[string]map[string]int, 0)
+	fmt.Println("# tld check status citation detail")
+	for _, tld := range tlds {
+		d := data[tld]
+		d.soaExpire = soaExpire[tld]
+		summary := summaryOf(tld)
+		if _, ok := count[summary]; !ok {
+			count[summary] = make(map[string]map[string]int, 0)
+		}
+		for _, result := range complianceChecks(d) {
+			fmt.Printf("%s %s %s %s %q\n", tld, result.check, result.status, result.citation, result.detail)
+			if _, ok := count[summary][result.check]; !ok {
+				count[summary][result.check] = make(map[string]int, 0)
+			}
+			count[summary][result.check][result.status]++
+		}
+	}
+
+	// summary as gnuplot comment
+	var summaries []string
+	for summary := range count {
+		summaries = append(summaries, summary)
+	}
+	sort.Strings(summaries)
+	for _, summary := range summaries {
+		for _, check := range []string{CHECK_VALIDITY_EXPIRE, CHECK_RESIGN_VALIDITY, CHECK_INCEPTION_SKEW, CHECK_TTL_VALIDITY, CHECK_CHAIN_OF_TRUST, CHECK_ZSK_ROLLOVER, CHECK_KSK_ROLLOVER, CHECK_ALGORITHM_ROLLOVER} {
+			c := count[summary][check]
+			fmt.Printf("# %s%s pass %d warn %d fail %d n/a %d\n", summary, check, c[STATUS_PASS], c[STATUS_WARN], c[STATUS_FAIL], c[STATUS_NA])
+		}
+	}
+}
+
+// complianceChecks evaluates all checks for one TLD
+func complianceChecks(d *complianceData) []complianceResult {
+	var results []complianceResult
+	result := func(check string, status string, citation string, format string, args ...interface{}) {
+		results = append(results, complianceResult{check: check, status: status, citation: citation, detail: fmt.Sprintf(format, args...)})
+	}
+	validity := median(d.validity)
+
+	// signatures must be valid longer than secondary name servers serve the zone
+	switch {
+	case len(d.validity) == 0 || d.soaExpire == 0:
+		result(CHECK_VALIDITY_EXPIRE, STATUS_NA, CITE_TIME_CONSIDERATIONS, "no signatures or SOA")
+	case validity < d.soaExpire:
+		result(CHECK_VALIDITY_EXPIRE, STATUS_FAIL, CITE_TIME_CONSIDERATIONS, "validity %s below SOA expire %s", days2str(validity), days2str(d.soaExpire))
+	case d.failures[RULE_SOA_EXPIRE] > 0:
+		result(CHECK_VALIDITY_EXPIRE, STATUS_WARN, CITE_TIME_CONSIDERATIONS, "%d of %d samples with remaining lifetime below SOA expire %s", d.failures[RULE_SOA_EXPIRE], d.samples, days2str(d.soaExpire))
+	default:
+		result(CHECK_VALIDITY_EXPIRE, STATUS_PASS, CITE_TIME_CONSIDERATIONS, "validity %s, SOA expire %s", days2str(validity), days2str(d.soaExpire))
+	}
+
+	// signatures must be replaced well before they expire
+	resign := median(d.resign)
+	switch {
+	case len(d.resign) == 0 || len(d.validity) == 0:
+		result(CHECK_RESIGN_VALIDITY, STATUS_NA, CITE_TIME_CONSIDERATIONS, "re-signs not seen")
+	case resign >= validity:
+		result(CHECK_RESIGN_VALIDITY, STATUS_FAIL, CITE_TIME_CONSIDERATIONS, "re-signs every %s, validity %s", days2str(resign), days2str(validity))
+	case d.soaExpire > 0 && validity-resign < d.soaExpire:
+		result(CHECK_RESIGN_VALIDITY, STATUS_WARN, CITE_TIME_CONSIDERATIONS, "re-signs every %s, remaining validity %s below SOA expire %s", days2str(resign), days2str(validity-resign), days2str(d.soaExpire))
+	default:
+		result(CHECK_RESIGN_VALIDITY, STATUS_PASS, CITE_TIME_CONSIDERATIONS, "re-signs every %s, validity %s", days2str(resign), days2str(validity))
+	}
+
+	// inceptions should be backdated for validators with clock skew
+	switch {
+	case !d.signed:
+		result(CHECK_INCEPTION_SKEW, STATUS_NA, CITE_TIME_CONSIDERATIONS, "no signatures")
+	case d.inception <= 0:
+		result(CHECK_INCEPTION_SKEW, STATUS_FAIL, CITE_TIME_CONSIDERATIONS, "inception not before the first observation")
+	case d.inception < INCEPTION_SKEW_MIN:
+		result(CHECK_INCEPTION_SKEW, STATUS_WARN, CITE_TIME_CONSIDERATIONS, "inception at most %s before the first observation", days2str(d.inception))
+	default:
+		result(CHECK_INCEPTION_SKEW, STATUS_PASS, CITE_TIME_CONSIDERATIONS, "inception at most %s before the first observation", days2str(d.inception))
+	}
+
+	// cached RR sets must not outlive their signatures
+	ttlFailures := d.failures[RULE_TTL] + d.failures[RULE_NEGATIVE_TTL]
+	switch {
+	case d.maxTTL == 0 || len(d.validity) == 0:
+		result(CHECK_TTL_VALIDITY, STATUS_NA, CITE_TIME_CONSIDERATIONS, "no signatures with original TTL")
+	case d.maxTTL >= validity:
+		result(CHECK_TTL_VALIDITY, STATUS_FAIL, CITE_TIME_CONSIDERATIONS, "TTL %s not below validity %s", days2str(d.maxTTL), days2str(validity))
+	case ttlFailures > 0:
+		result(CHECK_TTL_VALIDITY, STATUS_WARN, CITE_TIME_CONSIDERATIONS, "%d of %d samples with remaining lifetime below TTL", ttlFailures, d.samples)
+	default:
+		result(CHECK_TTL_VALIDITY, STATUS_PASS, CITE_TIME_CONSIDERATIONS, "TTL %s, validity %s", days2str(d.maxTTL), days2str(validity))
+	}
+
+	// chain of trust and rollover timing, the first violation is reported
+	for _, check := range []struct {
+		name     string
+		citation string
+	}{
+		{CHECK_CHAIN_OF_TRUST, CITE_CHAIN_OF_TRUST},
+		{CHECK_ZSK_ROLLOVER, CITE_ZSK_ROLLOVER},
+		{CHECK_KSK_ROLLOVER, CITE_KSK_ROLLOVER},
+		{CHECK_ALGORITHM_ROLLOVER, CITE_ALGORITHM_ROLLOVER},
+	} {
+		var violations []rolloverEvent
+		for _, e := range d.events {
+			if e.check == check.name {
+				violations = append(violations, e)
+			}
+		}
+		switch {
+		case len(violations) > 0:
+			first := violations[0]
+			result(check.name, STATUS_FAIL, first.citation, "%d violations, first %s %s", len(violations), first.when.Format(time.DateOnly), first.detail)
+		case check.name == CHECK_CHAIN_OF_TRUST && !d.chained:
+			result(check.name, STATUS_NA, check.citation, "no DS or signed DNSKEY set seen")
+		case check.name == CHECK_CHAIN_OF_TRUST:
+			result(check.name, STATUS_PASS, check.citation, "DS matches a key signing the DNSKEY set")
+		case d.rollovers[check.name] == 0:
+			result(check.name, STATUS_NA, check.citation, "no rollovers")
+		default:
+			result(check.name, STATUS_PASS, check.citation, "%d rollovers", d.rollovers[check.name])
+		}
+	}
+	return results
+}
@@ -0,0 +1,237 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// consistencyCmd compares the answers of all name servers of a TLD
+var consistencyCmd = &cobra.Command{
+	Use:     "consistency [--tld <name>]",
+	Version: "0.0.1a",
+	Short:   "compare the name servers of every TLD",
+	Long: `compare the name servers of every TLD
+
+Uses the data saved by 'measure --authoritative'. For every TLD and day the
+last answer of every name server is compared to the answers of its peers.
+Reported are servers with a different SOA serial, different RRSIG expiration
+times or a different DNSKEY set than the majority of the name servers.
+Expirations below the apex are checked per owner name (expiration-A/nic.se.),
+denial proofs are not compared as every query asks for another random name.
+If there is no majority the highest value (newest serial, latest expiration)
+is expected.
+
+Output columns: date tld check server value expected`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		consistencyRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(consistencyCmd)
+
+	// define command line arguments
+	addRunFlags(consistencyCmd)
+}
+
+// checks made by consistency
+const (
+	CONSISTENCY_SERIAL     = "serial"
+	CONSISTENCY_EXPIRATION = "expiration-"
+	CONSISTENCY_DNSKEY     = "dnskey"
+)
+
+// consistencyKey identifies the name servers of one TLD on one day
+type consistencyKey struct {
+	day time.Time
+	tld string
+}
+
+// consistencyValue is what a server answered, compare is used to find the peer value
+type consistencyValue struct {
+	compare string
+	show    string
+}
+
+func consistencyRun(args []string) {
+
+	// check TLD command line argument, compare all TLD if not given
+	// every owner name is checked on its own
+	var filter = storage.Filter{Source: storage.Authoritative, AllOwners: true}
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	rrData, err := store.RRSets(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// check -> server -> value, later answers of a server on the same day replace earlier ones
+	var values map[consistencyKey]map[string]map[string]consistencyValue = make(map[consistencyKey]map[string]map[string]consistencyValue, 0)
+	for _, rrset := range rrData {
+		// proofs differ with the random name asked for
+		if rrset.Server == "" || rrset.Proof {
+			continue
+		}
+		key := consistencyKey{day: normalizeDay(rrset.Resolved.UTC()), tld: rrset.TLD}
+		if _, ok := values[key]; !ok {
+			values[key] = make(map[string]map[string]consistencyValue, 0)
+		}
+		save := func(check string, value consistencyValue) {
+			if _, ok := values[key][check]; !ok {
+				values[key][check] = make(map[string]consistencyValue, 0)
+			}
+			values[key][check][rrset.Server] = value
+		}
+
+		// latest signature expiration of the RR set
+		var expiration time.Time
+		for _, sig := range rrset.Signatures {
+			if sig.Expiration.After(expiration) {
+				expiration = sig.Expiration
+			}
+		}
+		show := expiration.UTC().Format("20060102150405")
+		check := CONSISTENCY_EXPIRATION + dns.TypeToString[rrset.RRType]
+		if rrset.Owner != "" {
+			check += "/" + rrset.Owner
+		}
+		save(check, consistencyValue{compare: show, show: show})
+
+		// serial and key set are only compared at the apex
+		if rrset.Owner != "" {
+			continue
+		}
+		switch rrset.RRType {
+		case dns.TypeSOA:
+			rrs, err := rrset.RRs()
+			if err != nil {
+				log.Fatalf("%s %s SOA %s", rrset.Resolved.Format(time.DateOnly), rrset.TLD, err)
+			}
+			for _, rr := range rrs {
+				if soa, ok := rr.(*dns.SOA); ok {
+					// zero padded to compare serials as strings
+					save(CONSISTENCY_SERIAL, consistencyValue{compare: fmt.Sprintf("%010d", soa.Serial), show: fmt.Sprintf("%d", soa.Serial)})
+				}
+			}
+		case dns.TypeDNSKEY:
+			rrs, err := rrset.RRs()
+			if err != nil {
+				log.Fatalf("%s %s DNSKEY %s", rrset.Resolved.Format(time.DateOnly), rrset.TLD, err)
+			}
+			var keytags []string
+			for _, rr := range rrs {
+				if key, ok := rr.(*dns.DNSKEY); ok {
+					keytags = append(keytags, fmt.Sprintf("%d", key.KeyTag()))
+				}
+			}
+			sort.Strings(keytags)
+			save(CONSISTENCY_DNSKEY, consistencyValue{compare: rrset.RRData, show: strings.Join(keytags, ",")})
+		}
+	}
+
+	// print in order of day and TLD
+	var keys []consistencyKey
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].day.Equal(keys[j].day) {
+			return keys[i].tld < keys[j].tld
+		}
+		return keys[i].day.Before(keys[j].day)
+	})
+
+	var inconsistent int
+	for _, key := range keys {
+		var checks []string
+		for check := range values[key] {
+			checks = append(checks, check)
+		}
+		sort.Strings(checks)
+
+		var found bool
+		for _, check := range checks {
+			servers := values[key][check]
+			expected := peerValue(servers)
+			var names []string
+			for server := range servers {
+				names = append(names, server)
+			}
+			sort.Strings(names)
+			for _, server := range names {
+				if servers[server].compare == expected.compare {
+					continue
+				}
+				found = true
+				fmt.Printf("%s %s %s %s %s %s\n", key.day.Format(time.DateOnly), key.tld, check, server, servers[server].show, expected.show)
+			}
+		}
+		if found {
+			inconsistent++
+		}
+	}
+
+	// summary as gnuplot comment
+	fmt.Printf("# checked %d inconsistent %d\n", len(keys), inconsistent)
+}
+
+// peerValue returns the value most servers agree on.
+// Ties are broken by the highest value.
+func peerValue(servers map[string]consistencyValue) consistencyValue {
+	var count map[string]int = make(map[string]int, 0)
+	var byCompare map[string]consistencyValue = make(map[string]consistencyValue, 0)
+	for _, value := range servers {
+		count[value.compare]++
+		byCompare[value.compare] = value
+	}
+	var best string
+	for compare := range count {
+		if count[compare] > count[best] || (count[compare] == count[best] && compare > best) {
+			best = compare
+		}
+	}
+	return byCompare[best]
+}
@@ -41,13 +41,76 @@ const TLD_DESCRIPTION = "give TLD name to evalute"
 const RR = "rr"
 const RR_SHORT = "r"
 const RR_DEFAULT = ""
-const RR_DESCRIPTION = "which RR set is used for evaluation. Possible values NS or DNSKEY"
+const RR_DESCRIPTION = "which RR types are used for evaluation, any type or a comma separated list (e.g. NS,DNSKEY)"
+
+const SELECT = "select"
+const SELECT_MAX = "max"
+const SELECT_MIN = "min"
+const SELECT_KEYTAG = "keytag"
+const SELECT_DEFAULT = SELECT_MAX
+const SELECT_DESCRIPTION = "which RRSIG is used if an RR set has several signatures. Possible values max, min or keytag"
+
+const RUN = "run"
+const RUN_DESCRIPTION = "only use observations of this run (can be given several times)"
+const FROM = "from"
+const FROM_DESCRIPTION = "only use runs started on or after this date (YYYY-MM-DD)"
+const TO = "to"
+const TO_DESCRIPTION = "only use runs started on or before this date (YYYY-MM-DD)"
+const PARTIAL = "partial"
+const PARTIAL_DESCRIPTION = "allow runs that did not finish"
+const ALL_OWNERS = "all-owners"
+const ALL_OWNERS_DESCRIPTION = "also analyse RR sets of other owner names than the TLD, like nic.<tld> of --targets"
+
+const VIEW = "view"
+const VIEW_DAILY = "daily"
+const VIEW_SCORECARD = "scorecard"
+const VIEW_DEFAULT = VIEW_DAILY
+const VIEW_DESCRIPTION = "view of rfc6781, daily summary of signature lifetime and SOA expire or compliance scorecard per TLD (daily or scorecard)"
+
+const RULES = "rules"
+const RULES_DEFAULT = RULE_SOA_EXPIRE
+const RULES_DESCRIPTION = "rules of the failure model used by failed, rfc6781 and risk (soa-expire, ttl, negative-ttl)"
+const MAX_TTL = "max-ttl"
+const MAX_TTL_DEFAULT time.Duration = 24 * time.Hour
+const MAX_TTL_DESCRIPTION = "max cache TTL of resolvers, TTLs of the failure model are clamped to it (0 for no limit)"
+
+const ROOTDB = "rootdb"
+const ROOTDB_DESCRIPTION = "CSV export of the IANA root zone database (domain,type,sponsor,operator) to classify TLD"
+const TLD_LIST = "tld-list"
+const TLD_LIST_DESCRIPTION = "list of TLD as <attribute>=<file> to classify TLD, one TLD and an optional value per line (can be given several times)"
+const GROUP_BY = "group-by"
+const GROUP_BY_DESCRIPTION = "attribute TLD are grouped by in reports (tld, class, type, sponsor, operator or an attribute of --tld-list)"
+
+const FORCE = "force"
+const RESUME = "resume"
+
+const COMMIT_ROWS = "commit-rows"
+const COMMIT_ROWS_DEFAULT int = 1000
+const COMMIT_INTERVAL = "commit-interval"
+const COMMIT_INTERVAL_DEFAULT time.Duration = 30 * time.Second
 
 const DBCREDENTIALS = "dbcredentials"
 
+const REKEY_BATCH int = 1000
+
 const RESOLVERS = "resolvers"
 
-const TIMEOUT time.Duration = 5 // seconds
+const AUTHORITATIVE = "authoritative"
+const ROOTZONE = "rootzone"
+const TARGETS = "targets"
+
+const TIMEOUT = "timeout"
+const TIMEOUT_DEFAULT time.Duration = 5 * time.Second
+
+// politeness towards resolvers and name servers, zero does not limit
+const QPS = "qps"
+const RESOLVER_QPS = "resolver-qps"
+const ZONE_INFLIGHT = "zone-inflight"
+
+// retries of a query on the same server after timeouts or network errors
+const RETRY_ATTEMPTS int = 3
+const RETRY_BACKOFF time.Duration = 250 * time.Millisecond
+const RETRY_BACKOFF_MAX time.Duration = 4 * time.Second
 
 func init() {
 
@@ -0,0 +1,189 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/schema"
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// dbCmd groups all commands maintaining the database schema
+var dbCmd = &cobra.Command{
+	Use:     "db <init|migrate|status|rekey>",
+	Version: "0.0.1a",
+	Short:   "maintain the database schema",
+	Long:    "maintain the database schema",
+}
+
+var dbInitCmd = &cobra.Command{
+	Use:     "init",
+	Version: "0.0.1a",
+	Short:   "create all tables in an empty database",
+	Long:    "create all tables, indexes and the schema version table in an empty database",
+	Run:     func(cmd *cobra.Command, args []string) { dbInitRun(args) },
+	Args:    cobra.NoArgs,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:     "migrate",
+	Version: "0.0.1a",
+	Short:   "upgrade the database schema to the latest version",
+	Long:    "upgrade the database schema to the latest version",
+	Run:     func(cmd *cobra.Command, args []string) { dbMigrateRun(args) },
+	Args:    cobra.NoArgs,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:     "status",
+	Version: "0.0.1a",
+	Short:   "show the database schema version",
+	Long:    "show the database schema version and all pending migrations",
+	Run:     func(cmd *cobra.Command, args []string) { dbStatusRun(args) },
+	Args:    cobra.NoArgs,
+}
+
+var dbRekeyCmd = &cobra.Command{
+	Use:     "rekey",
+	Version: "0.0.1a",
+	Short:   "normalize RR sets stored before schema version 3",
+	Long: `normalize RR sets stored before schema version 3
+
+Older versions stored RRDATA with the TTL seen in the answer, so identical
+RR sets were stored again and again. rekey rewrites RRDATA with the original
+TTL of the signature, moves the observed TTL into RRSIG.TTL and deletes RRDATA
+rows that are no longer used. Rows without original TTL (written before schema
+version 2) only get their observed TTL saved.`,
+	Run:  func(cmd *cobra.Command, args []string) { dbRekeyRun(args) },
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbInitCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbRekeyCmd)
+}
+
+// openStore opens the database given in the configuration
+func openStore() storage.Store {
+	if viper.GetString(DBCREDENTIALS) == "" {
+		log.Fatal("No DB credentials given.")
+	}
+	store, err := storage.Open(viper.GetString(DBCREDENTIALS))
+	if err != nil {
+		log.Fatalf("Could not open DB %s", err.Error())
+	}
+	log.Debugf("DB OPEN (%s)", store.Dialect())
+	return store
+}
+
+// checkSchema stops the program if the database schema is not up to date
+func checkSchema(store storage.Store) {
+	if err := schema.Check(store.DB(), store.Dialect()); err != nil {
+		log.Fatalf("%s. Run 'dnssectiming db migrate' first.", err)
+	}
+}
+
+func dbInitRun(args []string) {
+	store := openStore()
+	defer store.Close()
+
+	current, err := schema.Current(store.DB(), store.Dialect())
+	if err != nil {
+		log.Fatalf("Could not read schema version %s", err)
+	}
+	if current > 0 {
+		log.Fatalf("Database is already initialised (schema version %d). Use 'dnssectiming db migrate' to upgrade.", current)
+	}
+
+	applied, err := schema.Migrate(store.DB(), store.Dialect())
+	if err != nil {
+		log.Fatalf("Could not initialise database %s", err)
+	}
+	for _, m := range applied {
+		fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+	}
+}
+
+func dbMigrateRun(args []string) {
+	store := openStore()
+	defer store.Close()
+
+	applied, err := schema.Migrate(store.DB(), store.Dialect())
+	for _, m := range applied {
+		fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalf("Could not migrate database %s", err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("schema is up to date")
+	}
+}
+
+func dbStatusRun(args []string) {
+	store := openStore()
+	defer store.Close()
+
+	migrations, err := schema.Migrations(store.Dialect())
+	if err != nil {
+		log.Fatalf("Could not read migrations %s", err)
+	}
+	history, err := schema.History(store.DB(), store.Dialect())
+	if err != nil {
+		log.Fatalf("Could not read schema version %s", err)
+	}
+	var appliedAt = make(map[int]time.Time, 0)
+	for _, a := range history {
+		appliedAt[a.Version] = a.Applied
+	}
+
+	current, _ := schema.Current(store.DB(), store.Dialect())
+	latest, _ := schema.Latest(store.Dialect())
+	fmt.Printf("schema version %d (latest %d)\n", current, latest)
+	for _, m := range migrations {
+		if t, ok := appliedAt[m.Version]; ok {
+			fmt.Printf("%04d %-30s applied %s\n", m.Version, m.Name, t.Format(time.DateTime))
+		} else {
+			fmt.Printf("%04d %-30s pending\n", m.Version, m.Name)
+		}
+	}
+}
+
+func dbRekeyRun(args []string) {
+	store := openStore()
+	defer store.Close()
+
+	// rekey needs the TTL column
+	checkSchema(store)
+
+	result, err := store.Rekey(REKEY_BATCH)
+	fmt.Printf("rekeyed %d\nwithout original TTL %d\ndeleted RRDATA %d\n", result.Rekeyed, result.NoOrigTTL, result.Deleted)
+	if err != nil {
+		log.Fatalf("Could not rekey database %s", err)
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// EDNS0 option code of extended DNS errors (RFC 8914)
+const EDNS0_EDE uint16 = 15
+
+// names of extended DNS error info codes (IANA registry)
+var edeNames = map[uint16]string{
+	0:  "Other",
+	1:  "Unsupported DNSKEY Algorithm",
+	2:  "Unsupported DS Digest Type",
+	3:  "Stale Answer",
+	4:  "Forged Answer",
+	5:  "DNSSEC Indeterminate",
+	6:  "DNSSEC Bogus",
+	7:  "Signature Expired",
+	8:  "Signature Not Yet Valid",
+	9:  "DNSKEY Missing",
+	10: "RRSIGs Missing",
+	11: "No Zone Key Bit Set",
+	12: "NSEC Missing",
+	13: "Cached Error",
+	14: "Not Ready",
+	15: "Blocked",
+	16: "Censored",
+	17: "Filtered",
+	18: "Prohibited",
+	19: "Stale NXDOMAIN Answer",
+	20: "Not Authoritative",
+	21: "Not Supported",
+	22: "No Reachable Authority",
+	23: "Network Error",
+	24: "Invalid Data",
+	25: "Signature Expired before Valid",
+	26: "Too Early",
+	27: "Unsupported NSEC3 Iterations Value",
+}
+
+// edeDNSSEC are the info codes that report a DNSSEC problem
+var edeDNSSEC = map[uint16]bool{1: true, 2: true, 5: true, 6: true, 7: true, 8: true, 9: true, 10: true, 11: true, 12: true, 25: true, 27: true}
+
+// edeName returns the name of an info code
+func edeName(code uint16) string {
+	if name, ok := edeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code%d", code)
+}
+
+// extendedErrors returns all extended DNS errors of an answer.
+// miekg/dns v1.1.26 does not know EDE, the option is read from EDNS0_LOCAL.
+func extendedErrors(r *dns.Msg) []storage.ExtendedError {
+	if r == nil {
+		return nil
+	}
+	opt := r.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	var errs []storage.ExtendedError
+	for _, option := range opt.Option {
+		local, ok := option.(*dns.EDNS0_LOCAL)
+		if !ok || local.Code != EDNS0_EDE || len(local.Data) < 2 {
+			continue
+		}
+		errs = append(errs, storage.ExtendedError{Code: binary.BigEndian.Uint16(local.Data[:2]), Text: string(local.Data[2:])})
+	}
+	return errs
+}
+
+// edeCmd lists the TLD with DNSSEC related extended DNS errors per day
+var edeCmd = &cobra.Command{
+	Use:     "ede [--tld <name>] [--rr <type>[,<type>...]]",
+	Version: "0.0.1a",
+	Short:   "list TLD with DNSSEC related extended DNS errors per day",
+	Long: `list TLD with DNSSEC related extended DNS errors per day
+
+Resolvers explain failed validations with extended DNS errors (RFC 8914).
+All extended errors are saved by measure, this report lists the DNSSEC
+related ones (codes 1, 2, 5-12, 25 and 27).
+
+Output columns: date tld code name answers servers text`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		edeRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(edeCmd)
+
+	// define command line arguments
+	addRunFlags(edeCmd)
+}
+
+// edeKey identifies one line of the ede report
+type edeKey struct {
+	day    time.Time
+	tld    string
+	rrtype uint16
+	code   uint16
+}
+
+// edeReport collects the answers of one line of the ede report
+type edeReport struct {
+	answers int
+	servers map[string]bool
+	texts   map[string]bool
+}
+
+func edeRun(args []string) {
+
+	// check TLD command line argument, report all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, report all types if not given
+	rrtypes := getRRTypes(false)
+	filter.RRTypes = rrtypes
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	attempts, err := store.Attempts(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var reports map[edeKey]*edeReport = make(map[edeKey]*edeReport, 0)
+	var total map[uint16]int = make(map[uint16]int, 0)
+	for _, attempt := range attempts {
+		for _, e := range attempt.ExtendedErrors {
+			if !edeDNSSEC[e.Code] {
+				continue
+			}
+			key := edeKey{day: normalizeDay(attempt.Sent.UTC()), tld: attempt.TLD, code: e.Code}
+			if len(rrtypes) > 1 {
+				key.rrtype = attempt.RRType
+			}
+			if _, ok := reports[key]; !ok {
+				reports[key] = &edeReport{servers: make(map[string]bool, 0), texts: make(map[string]bool, 0)}
+			}
+			reports[key].answers++
+			reports[key].servers[attempt.Server] = true
+			if e.Text != "" {
+				reports[key].texts[e.Text] = true
+			}
+			total[e.Code]++
+		}
+	}
+
+	var keys []edeKey
+	for key := range reports {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].day.Equal(keys[j].day) {
+			return keys[i].day.Before(keys[j].day)
+		}
+		if keys[i].tld != keys[j].tld {
+			return keys[i].tld < keys[j].tld
+		}
+		if keys[i].rrtype != keys[j].rrtype {
+			return keys[i].rrtype < keys[j].rrtype
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	fmt.Printf("# date tld%s code name answers servers text\n", rrtypeHeader(rrtypes))
+	for _, key := range keys {
+		report := reports[key]
+		fmt.Printf("%s %s%s %d %q %d %s %q\n", key.day.Format(time.DateOnly), key.tld, rrtypeColumn(rrtypes, key.rrtype), key.code, edeName(key.code), report.answers, strings.Join(sortedKeys(report.servers), ","), strings.Join(sortedKeys(report.texts), "; "))
+	}
+
+	var codes []uint16
+	for code := range total {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		fmt.Printf("# %d %q %d answers\n", code, edeName(code), total[code])
+	}
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
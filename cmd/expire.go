@@ -20,17 +20,13 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/miekg/dns"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ulrichwisser/dnssectiming/storage"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -62,48 +58,28 @@ func init() {
 	// add the command to cobra
 	rootCmd.AddCommand(expireCmd)
 
-	// Use flags for viper values
-	viper.BindPFlags(expireCmd.Flags())
+	// define command line arguments
+	addRunFlags(expireCmd)
 }
 
 func expireRun(args []string) {
 
 	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
-	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Could not ping DB %s", err.Error())
-	}
-	log.Debug("DB OPEN")
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	runs := getRuns(store)
 
 	//
 	// Get SOA Expire
 	//
-	soaData, err := db.Query("SELECT RESOLVED,TLD,RRDATA FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE RRTYPE=? ORDER BY RESOLVED,TLD", dns.TypeSOA)
+	soaData, err := store.SOAs(storage.Filter{Runs: runs})
 	if err != nil {
-		log.Fatalf("Could not query for SOA data %s", err)
+		log.Fatal(err.Error())
 	}
-	defer soaData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	for soaData.Next() {
-		var resolved time.Time
-		var tld string
-		var rrdata string
-		err := soaData.Scan(&resolved, &tld, &rrdata)
-		if err != nil {
-			log.Fatalf("Error scanning SOA data %s", err)
-		}
-		rr, err := dns.NewRR(rrdata)
-		if err != nil {
-			log.Fatalf("Could not parse SOA record >%<\n%s", rrdata, err)
-		}
-		fmt.Printf("%s %s %d\n", resolved.Format(time.DateOnly), tld, rr.(*dns.SOA).Expire)
+
+	for _, soa := range soaData {
+		fmt.Printf("%s %s %d\n", soa.Resolved.Format(time.DateOnly), soa.TLD, soa.Record.Expire)
 	}
 }
@@ -18,20 +18,17 @@ package cmd
 
 import (
 	"fmt"
-	"sort"
+	"strings"
 	"time"
 
-	"github.com/miekg/dns"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ulrichwisser/dnssectiming/storage"
+	"github.com/ulrichwisser/dnssectiming/tldclass"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -63,149 +60,162 @@ func init() {
 	// add the command to cobra
 	rootCmd.AddCommand(failedCmd)
 
-	// Use flags for viper values
-	viper.BindPFlags(failedCmd.Flags())
+	// define command line arguments
+	addFailureModelFlags(failedCmd)
+	addRunFlags(failedCmd)
+	addSelectFlag(failedCmd)
+	addAllOwnersFlag(failedCmd)
+	addGroupFlags(failedCmd)
 }
 
 func failedRun(args []string) {
 
 	// check RR command line arguments
-	var rrtype uint16 = 0
-	var rr_str = viper.GetString(RR)
-	if rr_str == "NS" {
-		rrtype = dns.TypeNS
-	}
-	if rr_str == "DNSKEY" {
-		rrtype = dns.TypeDNSKEY
-	}
-	if rrtype == 0 {
-		log.Fatal("No valid RR type was given. Must be one of NS or DNSKEY")
-	}
-	log.Debugf("RRTYPE %s %d", rr_str, rrtype)
+	rrtypes := getRRTypes(true)
+
+	// check select command line argument
+	sel := getSelect()
+
+	// check failure model command line arguments
+	model := getFailureModel()
+
+	// check classification command line arguments, ccTLD and gTLD if not given
+	groups := getGroups(tldclass.AttrClass)
 
 	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
-	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Could not ping DB %s", err.Error())
-	}
-	log.Debug("DB OPEN")
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	runs := getRuns(store)
 
 	//
-	// Get SOA Expire
+	// Get SOA
 	//
-	soaData, err := db.Query("SELECT RESOLVED,TLD,RRDATA FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE RRTYPE=? ORDER BY RESOLVED,TLD ", dns.TypeSOA)
+	soaData, err := store.SOAs(storage.Filter{Runs: runs})
 	if err != nil {
-		log.Fatalf("Could not query for SOA data %s", err)
+		log.Fatal(err.Error())
 	}
-	defer soaData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var soaByDateTLD map[time.Time]map[string]uint32 = make(map[time.Time]map[string]uint32, 0)
-	for soaData.Next() {
-		var resolved time.Time
-		var tld string
-		var rrdata string
-		err := soaData.Scan(&resolved, &tld, &rrdata)
-		if err != nil {
-			log.Fatalf("Error scanning SOA data %s", err)
-		}
-		rr, err := dns.NewRR(rrdata)
-		if err != nil {
-			log.Fatalf("Could not parse SOA record >%<\n%s", rrdata, err)
-		}
-
-		// prepare data structure
-		if _, ok := soaByDateTLD[resolved]; !ok {
-			soaByDateTLD[resolved] = make(map[string]uint32, 0)
-		}
 
-		// save data
-		soaByDateTLD[resolved][tld] = rr.(*dns.SOA).Expire
-	}
+	soaByProbe := newSOAIndex(soaData)
 
 	//
 	// Get lifetime
 	//
-	rrData, err := db.Query("SELECT RESOLVED,TLD,EXPIRATION FROM RRSIG WHERE RRTYPE=? ORDER BY RESOLVED,TLD ", rrtype)
+	rrData, err := store.Signatures(storage.Filter{RRTypes: rrtypes, Runs: runs, AllOwners: viper.GetBool(ALL_OWNERS)})
 	if err != nil {
-		log.Fatalf("Could not query for %s data %s", rr_str, err)
+		log.Fatal(err.Error())
 	}
-	defer rrData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var failedByDateTLD map[time.Time]map[string]bool = make(map[time.Time]map[string]bool, 0)
-	for rrData.Next() {
-		var resolved time.Time
-		var tld string
-		var expiration time.Time
-		err := rrData.Scan(&resolved, &tld, &expiration)
-		if err != nil {
-			log.Fatalf("Error scanning RR data. %s", err)
-		}
-		expire, ok := soaByDateTLD[resolved][tld]
+	rrData = selectSignatures(rrData, sel)
+
+	// rules failed by every sample
+	var failedByDateTLD map[time.Time]map[sampleKey][]string = make(map[time.Time]map[sampleKey][]string, 0)
+	var dropped int
+	for _, sig := range rrData {
+		resolved := normalizeDay(sig.Resolved.UTC())
+		soa, ok := soaByProbe.of(sig)
 		if !ok {
+			log.Debugf("%s %s no SOA in probe", sig.Resolved.Format(time.DateTime), sig.TLD)
+			dropped++
 			continue
 		}
-		lifetime := expiration.UTC().Unix() - resolved.UTC().Unix()
 
 		// prepare data structure
 		if _, ok := failedByDateTLD[resolved]; !ok {
-			failedByDateTLD[resolved] = make(map[string]bool, 0)
+			failedByDateTLD[resolved] = make(map[sampleKey][]string, 0)
 		}
 
 		// save data
-		failedByDateTLD[resolved][tld] = lifetime < int64(expire)
+		failedByDateTLD[resolved][sampleKeyOf(sig, sel)] = model.failed(failureSample{Signature: sig, SOA: soa})
 	}
 
 	//
 	// compute daily summary
 	//
-	type dateStats struct {
-		ccOK     int
-		ccFail   int
-		gtldOK   int
-		gtldFail int
+	type groupStats struct {
+		ok   int
+		fail int
 	}
-	var statsByDate map[time.Time]*dateStats = make(map[time.Time]*dateStats, 0)
+	var statsByDate map[dateKey]map[string]*groupStats = make(map[dateKey]map[string]*groupStats, 0)
+	var failedByRule map[string]int = make(map[string]int, 0)
+	var tlds map[string]bool = make(map[string]bool, 0)
 	for resolved := range failedByDateTLD {
-		for tld := range failedByDateTLD[resolved] {
+		for sample, rules := range failedByDateTLD[resolved] {
+			failed := len(rules) > 0
+			for _, rule := range rules {
+				failedByRule[rule]++
+			}
+
 			// prepare data structure
-			if _, ok := statsByDate[resolved]; !ok {
-				statsByDate[resolved] = &dateStats{}
+			key := dateKeyOf(rrtypes, resolved, sample.rrtype)
+			group := groups.of(sample.tld)
+			tlds[sample.tld] = true
+			if _, ok := statsByDate[key]; !ok {
+				statsByDate[key] = make(map[string]*groupStats, 0)
+			}
+			if _, ok := statsByDate[key][group]; !ok {
+				statsByDate[key][group] = &groupStats{}
 			}
 
-			if len(tld) == 3 {
-				if failedByDateTLD[resolved][tld] {
-					statsByDate[resolved].ccFail++
-				} else {
-					statsByDate[resolved].ccOK++
-				}
+			if failed {
+				statsByDate[key][group].fail++
 			} else {
-				if failedByDateTLD[resolved][tld] {
-					statsByDate[resolved].gtldFail++
-				} else {
-					statsByDate[resolved].gtldOK++
-				}
+				statsByDate[key][group].ok++
 			}
 		}
 	}
 
 	// get sorted lists of resolved
-	var resolvedList []time.Time
-	for resolved := range soaByDateTLD {
-		resolvedList = append(resolvedList, resolved)
+	var resolvedList []dateKey
+	for key := range statsByDate {
+		resolvedList = append(resolvedList, key)
+	}
+	sortDateKeys(resolvedList)
+
+	// one column pair for every group
+	var tldList []string
+	for tld := range tlds {
+		tldList = append(tldList, tld)
+	}
+	values := groups.values(tldList)
+	var header []string
+	for _, value := range values {
+		header = append(header, value+"-ok", value+"-fail")
 	}
-	sort.Slice(resolvedList, func(i, j int) bool { return resolvedList[i].Before(resolvedList[j]) })
 
 	// output final result
-	for _, resolved := range resolvedList {
-		fmt.Printf("%s %d %d %d %d\n", resolved.Format(time.DateOnly), statsByDate[resolved].ccOK, statsByDate[resolved].ccFail, statsByDate[resolved].gtldOK, statsByDate[resolved].gtldFail)
+	fmt.Printf("# date%s %s\n", rrtypeHeader(rrtypes), strings.Join(header, " "))
+	for _, key := range resolvedList {
+		var counts []string
+		for _, value := range values {
+			s, ok := statsByDate[key][value]
+			if !ok {
+				s = &groupStats{}
+			}
+			counts = append(counts, fmt.Sprintf("%d %d", s.ok, s.fail))
+		}
+		fmt.Printf("%s%s %s\n", key.date.Format(time.DateOnly), rrtypeColumn(rrtypes, key.rrtype), strings.Join(counts, " "))
+	}
+	fmt.Printf("# dropped %d samples without SOA\n", dropped)
+	for _, rule := range model.names() {
+		fmt.Printf("# failed %s %d samples\n", rule, failedByRule[rule])
+	}
+
+	// queries without signed answer as gnuplot comment
+	attempts, err := store.Attempts(storage.Filter{RRTypes: rrtypes, Runs: runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var outcomes map[storage.Outcome]int = make(map[storage.Outcome]int, 0)
+	for _, byOutcome := range finalOutcomes(attempts, rrtypes) {
+		for outcome, count := range byOutcome {
+			outcomes[outcome] += count
+		}
+	}
+	for _, outcome := range allOutcomes {
+		if outcome != storage.OutcomeOK && outcomes[outcome] > 0 {
+			fmt.Printf("# %s %d queries\n", outcome, outcomes[outcome])
+		}
 	}
 
 }
@@ -0,0 +1,200 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// rules of the failure model
+const (
+	RULE_SOA_EXPIRE   = "soa-expire"
+	RULE_TTL          = "ttl"
+	RULE_NEGATIVE_TTL = "negative-ttl"
+)
+
+// failureSample is a signature with the SOA record seen in the same probe
+type failureSample struct {
+	Signature storage.Signature
+	SOA       *dns.SOA // nil if the probe has no SOA record
+}
+
+// failureRule is one rule of the failure model.
+// Required returns the remaining lifetime in seconds a signature needs,
+// 0 if the rule does not apply to the sample.
+type failureRule interface {
+	Name() string
+	Required(s failureSample) int64
+}
+
+// soaExpireRule: secondary name servers serve the zone until SOA expire
+type soaExpireRule struct{}
+
+func (soaExpireRule) Name() string { return RULE_SOA_EXPIRE }
+
+func (soaExpireRule) Required(s failureSample) int64 {
+	if s.SOA == nil {
+		return 0
+	}
+	return int64(s.SOA.Expire)
+}
+
+// ttlRule: resolvers cache the RR set for its original TTL, at most for their max TTL
+type ttlRule struct {
+	maxTTL int64
+}
+
+func (ttlRule) Name() string { return RULE_TTL }
+
+func (r ttlRule) Required(s failureSample) int64 {
+	// signatures stored before schema version 2 only have the observed TTL
+	ttl := int64(s.Signature.OrigTTL)
+	if ttl == 0 {
+		ttl = int64(s.Signature.TTL)
+	}
+	return clampTTL(ttl, r.maxTTL)
+}
+
+// negativeTTLRule: resolvers cache denials of existence for the SOA minimum or
+// the SOA TTL, whichever is lower (RFC 2308), at most for their max TTL.
+// It applies to NSEC, NSEC3 and the SOA record of denials of existence.
+type negativeTTLRule struct {
+	maxTTL int64
+}
+
+func (negativeTTLRule) Name() string { return RULE_NEGATIVE_TTL }
+
+func (r negativeTTLRule) Required(s failureSample) int64 {
+	if s.SOA == nil {
+		return 0
+	}
+	switch {
+	case s.Signature.RRType == dns.TypeNSEC, s.Signature.RRType == dns.TypeNSEC3:
+	case s.Signature.RRType == dns.TypeSOA && s.Signature.Proof:
+	default:
+		return 0
+	}
+	ttl := int64(s.SOA.Minttl)
+	if int64(s.SOA.Hdr.Ttl) < ttl {
+		ttl = int64(s.SOA.Hdr.Ttl)
+	}
+	return clampTTL(ttl, r.maxTTL)
+}
+
+// clampTTL limits a TTL to the max TTL of resolvers, 0 is no limit
+func clampTTL(ttl int64, maxTTL int64) int64 {
+	if maxTTL > 0 && ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
+
+// newRule returns the rule with the given name, nil if there is none
+func newRule(name string, maxTTL int64) failureRule {
+	switch name {
+	case RULE_SOA_EXPIRE:
+		return soaExpireRule{}
+	case RULE_TTL:
+		return ttlRule{maxTTL: maxTTL}
+	case RULE_NEGATIVE_TTL:
+		return negativeTTLRule{maxTTL: maxTTL}
+	}
+	return nil
+}
+
+// ruleNames returns the names of all rules
+func ruleNames() []string {
+	return []string{RULE_SOA_EXPIRE, RULE_TTL, RULE_NEGATIVE_TTL}
+}
+
+// failureModel decides if a signature could fail validation before it is replaced
+type failureModel struct {
+	rules []failureRule
+}
+
+// addFailureModelFlags adds the rules and max TTL command line arguments to a command using the failure model
+func addFailureModelFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice(RULES, []string{RULES_DEFAULT}, RULES_DESCRIPTION)
+	cmd.Flags().Duration(MAX_TTL, MAX_TTL_DEFAULT, MAX_TTL_DESCRIPTION)
+}
+
+// getFailureModel checks the rules and max TTL command line arguments
+func getFailureModel() failureModel {
+	maxTTL := int64(viper.GetDuration(MAX_TTL) / time.Second)
+	if maxTTL < 0 {
+		log.Fatal("max-ttl must not be negative")
+	}
+	var model failureModel
+	for _, name := range viper.GetStringSlice(RULES) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		rule := newRule(name, maxTTL)
+		if rule == nil {
+			log.Fatalf("Unknown rule %s. Must be one of %s", name, strings.Join(ruleNames(), ", "))
+		}
+		model.rules = append(model.rules, rule)
+	}
+	if len(model.rules) == 0 {
+		log.Fatal("No rules for the failure model were given")
+	}
+	return model
+}
+
+// names returns the names of all rules of the model
+func (m failureModel) names() []string {
+	var names []string
+	for _, rule := range m.rules {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+// failed returns the rules the remaining lifetime of the sample is too short for
+func (m failureModel) failed(s failureSample) []string {
+	lifetime := s.Signature.Lifetime()
+	var failed []string
+	for _, rule := range m.rules {
+		if required := rule.Required(s); required > 0 && lifetime < required {
+			failed = append(failed, rule.Name())
+		}
+	}
+	return failed
+}
+
+// required returns the longest remaining lifetime needed by any rule and its name
+func (m failureModel) required(s failureSample) (int64, string) {
+	var required int64
+	var name string
+	for _, rule := range m.rules {
+		if r := rule.Required(s); r > required {
+			required, name = r, rule.Name()
+		}
+	}
+	return required, name
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// testSOA returns a SOA record with the given TTL, expire and minimum
+func testSOA(ttl uint32, expire uint32, minttl uint32) *dns.SOA {
+	return &dns.SOA{Hdr: dns.RR_Header{Name: "se.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl}, Ns: "ns1.se.", Mbox: "hostmaster.se.", Serial: 2024010101, Refresh: 1800, Retry: 900, Expire: expire, Minttl: minttl}
+}
+
+func TestSOAExpireRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample failureSample
+		want   int64
+	}{
+		{"no SOA", failureSample{Signature: storage.Signature{RRType: dns.TypeSOA}}, 0},
+		{"SOA expire", failureSample{Signature: storage.Signature{RRType: dns.TypeDNSKEY}, SOA: testSOA(3600, 1209600, 900)}, 1209600},
+	}
+	for _, test := range tests {
+		if got := (soaExpireRule{}).Required(test.sample); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTTLRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxTTL int64
+		sig    storage.Signature
+		want   int64
+	}{
+		{"original TTL", 0, storage.Signature{OrigTTL: 86400, TTL: 300}, 86400},
+		{"observed TTL without original TTL", 0, storage.Signature{TTL: 300}, 300},
+		{"no TTL", 0, storage.Signature{}, 0},
+		{"max TTL", 3600, storage.Signature{OrigTTL: 86400, TTL: 300}, 3600},
+		{"below max TTL", 3600, storage.Signature{OrigTTL: 600}, 600},
+		{"max TTL without original TTL", 3600, storage.Signature{TTL: 7200}, 3600},
+	}
+	for _, test := range tests {
+		if got := (ttlRule{maxTTL: test.maxTTL}).Required(failureSample{Signature: test.sig}); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestNegativeTTLRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		maxTTL int64
+		sig    storage.Signature
+		soa    *dns.SOA
+		want   int64
+	}{
+		{"NSEC minimum", 0, storage.Signature{RRType: dns.TypeNSEC}, testSOA(3600, 1209600, 900), 900},
+		{"NSEC3 SOA TTL", 0, storage.Signature{RRType: dns.TypeNSEC3}, testSOA(600, 1209600, 900), 600},
+		{"SOA of denial", 0, storage.Signature{RRType: dns.TypeSOA, Proof: true}, testSOA(3600, 1209600, 900), 900},
+		{"SOA", 0, storage.Signature{RRType: dns.TypeSOA}, testSOA(3600, 1209600, 900), 0},
+		{"other type", 0, storage.Signature{RRType: dns.TypeDNSKEY}, testSOA(3600, 1209600, 900), 0},
+		{"no SOA", 0, storage.Signature{RRType: dns.TypeNSEC}, nil, 0},
+		{"max TTL", 300, storage.Signature{RRType: dns.TypeNSEC}, testSOA(3600, 1209600, 900), 300},
+	}
+	for _, test := range tests {
+		if got := (negativeTTLRule{maxTTL: test.maxTTL}).Required(failureSample{Signature: test.sig, SOA: test.soa}); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestClampTTL(t *testing.T) {
+	tests := []struct {
+		ttl    int64
+		maxTTL int64
+		want   int64
+	}{
+		{86400, 0, 86400},
+		{86400, 3600, 3600},
+		{3600, 3600, 3600},
+		{300, 3600, 300},
+		{0, 3600, 0},
+	}
+	for _, test := range tests {
+		if got := clampTTL(test.ttl, test.maxTTL); got != test.want {
+			t.Errorf("clampTTL(%d, %d): got %d, want %d", test.ttl, test.maxTTL, got, test.want)
+		}
+	}
+}
+
+func TestFailureModel(t *testing.T) {
+	model := failureModel{rules: []failureRule{soaExpireRule{}, ttlRule{}, negativeTTLRule{}}}
+	resolved := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	soa := testSOA(3600, 7*24*3600, 900)
+
+	tests := []struct {
+		name     string
+		sig      storage.Signature
+		failed   []string
+		required int64
+		rule     string
+	}{
+		{"long lifetime", storage.Signature{RRType: dns.TypeDNSKEY, OrigTTL: 3600, Expiration: resolved.Add(10 * 24 * time.Hour)}, nil, 7 * 24 * 3600, RULE_SOA_EXPIRE},
+		{"shorter than SOA expire", storage.Signature{RRType: dns.TypeDNSKEY, OrigTTL: 3600, Expiration: resolved.Add(2 * 24 * time.Hour)}, []string{RULE_SOA_EXPIRE}, 7 * 24 * 3600, RULE_SOA_EXPIRE},
+		{"shorter than all", storage.Signature{RRType: dns.TypeNSEC, OrigTTL: 3600, Expiration: resolved.Add(time.Minute)}, []string{RULE_SOA_EXPIRE, RULE_TTL, RULE_NEGATIVE_TTL}, 7 * 24 * 3600, RULE_SOA_EXPIRE},
+	}
+	for _, test := range tests {
+		test.sig.Resolved = resolved
+		sample := failureSample{Signature: test.sig, SOA: soa}
+		if got := model.failed(sample); !reflect.DeepEqual(got, test.failed) {
+			t.Errorf("%s: failed %v, want %v", test.name, got, test.failed)
+		}
+		if required, rule := model.required(sample); required != test.required || rule != test.rule {
+			t.Errorf("%s: required %d %s, want %d %s", test.name, required, rule, test.required, test.rule)
+		}
+	}
+}
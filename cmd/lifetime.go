@@ -28,13 +28,11 @@ import (
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ulrichwisser/dnssectiming/storage"
 )
 
 var lifetimeCmd = &cobra.Command{
-	Use:     "lifetime --tld <name> --rr <NS|DNSKEY>",
+	Use:     "lifetime --tld <name> --rr <type>[,<type>...]",
 	Version: "0.0.1a",
 	Short:   "get DNSSEC timing data for specific TLD and rr type",
 	Long:    "get DNSSEC timing data for specific TLD and rr type",
@@ -60,6 +58,11 @@ var lifetimeCmd = &cobra.Command{
 func init() {
 	// add the command to cobra
 	rootCmd.AddCommand(lifetimeCmd)
+
+	// define command line arguments
+	addRunFlags(lifetimeCmd)
+	addSelectFlag(lifetimeCmd)
+	addAllOwnersFlag(lifetimeCmd)
 }
 
 func lifetimeRun(args []string) {
@@ -73,96 +76,77 @@ func lifetimeRun(args []string) {
 	log.Debugf("TLD: %s", tld)
 
 	// check RR command line arguments
-	var rrtype uint16 = 0
-	var rr_str = viper.GetString(RR)
-	if rr_str == "NS" {
-		rrtype = dns.TypeNS
-	}
-	if rr_str == "DNSKEY" {
-		rrtype = dns.TypeDNSKEY
-	}
-	if rrtype == 0 {
-		log.Fatal("No valid RR type was given. Must be one of NS or DNSKEY")
-	}
-	log.Debugf("RRTYPE %s %d", rr_str, rrtype)
+	rrtypes := getRRTypes(true)
+
+	// check select command line argument
+	sel := getSelect()
 
 	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
-	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Could not ping DB %s", err.Error())
-	}
-	log.Debug("DB OPEN")
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	runs := getRuns(store)
 
 	//
 	// Get SOA Expire
 	//
-	soaData, err := db.Query("SELECT RESOLVED,RRDATA FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE TLD=? AND RRTYPE=? ORDER BY RESOLVED ", tld, dns.TypeSOA)
+	soaData, err := store.SOAs(storage.Filter{TLD: tld, Runs: runs})
 	if err != nil {
-		log.Fatalf("Could not query for SOA data %s", err)
+		log.Fatal(err.Error())
 	}
-	defer soaData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var soaByDate map[time.Time]uint32 = make(map[time.Time]uint32, 0)
-	for soaData.Next() {
-		var resolved time.Time
-		var rrdata string
-		err := soaData.Scan(&resolved, &rrdata)
-		if err != nil {
-			log.Fatalf("Error scanning SOA data %s", err)
-		}
-		rr, err := dns.NewRR(rrdata)
-		if err != nil {
-			log.Fatalf("Could not parse SOA record >%<\n%s", rrdata, err)
-		}
-		soaByDate[resolved] = rr.(*dns.SOA).Expire
-		log.Debugf("%s %s Expire %d\n", resolved.Format(time.DateOnly), tld, soaByDate[resolved])
+
+	soaByProbe := newSOAIndex(soaData)
+	for _, soa := range soaData {
+		log.Debugf("%s %s Expire %d\n", soa.Resolved.Format(time.DateOnly), tld, soa.Record.Expire)
 	}
 
 	//
 	// Get lifetime
 	//
-	rrData, err := db.Query("SELECT RESOLVED,EXPIRATION FROM RRSIG WHERE TLD=? AND RRTYPE=? ORDER BY RESOLVED ", tld, rrtype)
+	rrData, err := store.Signatures(storage.Filter{TLD: tld, RRTypes: rrtypes, Runs: runs, AllOwners: viper.GetBool(ALL_OWNERS)})
 	if err != nil {
-		log.Fatalf("Could not query for %s data %s", rr_str, err)
+		log.Fatal(err.Error())
 	}
-	defer rrData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var first bool = true
-	var lastResolved time.Time
-	for rrData.Next() {
-		var resolved time.Time
-		var expiration time.Time
-		err := rrData.Scan(&resolved, &expiration)
+	rrData = selectSignatures(rrData, sel)
+
+	// dates without data are tracked per RR type
+	var dropped int
+	var lastResolved map[uint16]time.Time = make(map[uint16]time.Time, 0)
+	for _, sig := range rrData {
+		resolved := sig.Resolved
+		expiration := sig.Expiration
+		column := rrtypeColumn(rrtypes, sig.RRType)
 		log.Debugf("Resolved: %v    Expiration: %v", resolved, expiration)
-		if err != nil {
-			log.Fatalf("Error scanning RR data. %s", err)
-		}
 		// check for dates without data
-		if first {
-			lastResolved = normalizeDay(resolved)
-			first = false
+		if _, ok := lastResolved[sig.RRType]; !ok {
+			lastResolved[sig.RRType] = normalizeDay(resolved)
 		}
-        var currResolved = normalizeDay(resolved)
-		for d := lastResolved.AddDate(0, 0, 1); d.Before(currResolved); d = d.AddDate(0, 0, 1) {
-    		fmt.Printf("%s NaN NaN\n", d.Format(time.DateOnly))
+		var currResolved = normalizeDay(resolved)
+		for d := lastResolved[sig.RRType].AddDate(0, 0, 1); d.Before(currResolved); d = d.AddDate(0, 0, 1) {
+			if sel == SELECT_KEYTAG {
+				fmt.Printf("%s%s NaN NaN NaN\n", d.Format(time.DateOnly), column)
+			} else {
+				fmt.Printf("%s%s NaN NaN\n", d.Format(time.DateOnly), column)
+			}
 			log.Debugf("%s %s Missing date", d.Format(time.DateOnly), tld)
 		}
-		expire, ok := soaByDate[resolved]
+		soa, ok := soaByProbe.of(sig)
 		if !ok {
+			log.Debugf("%s %s no SOA in probe", resolved.Format(time.DateTime), tld)
+			dropped++
 			continue
 		}
-		lifetime := expiration.UTC().Unix() - resolved.UTC().Unix()
-		fmt.Printf("%s %d %d\n", resolved.Format(time.DateOnly), lifetime, expire)
+		expire := soa.Expire
+		lifetime := sig.Lifetime()
+		if sel == SELECT_KEYTAG {
+			fmt.Printf("%s%s %d %d %d\n", resolved.Format(time.DateOnly), column, lifetime, expire, sig.KeyTag)
+		} else {
+			fmt.Printf("%s%s %d %d\n", resolved.Format(time.DateOnly), column, lifetime, expire)
+		}
 		log.Debugf("%s %s Lifetime: %s (%d) Expire: %s (%d) Expiration: %v", resolved.Format(time.DateOnly), tld, sec2str(lifetime), lifetime, sec2str(int64(expire)), expire, expiration)
-		lastResolved = currResolved
+		lastResolved[sig.RRType] = currResolved
 	}
+	fmt.Printf("# dropped %d samples without SOA\n", dropped)
 
 }
@@ -0,0 +1,110 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces queries evenly, a nil rateLimiter does not limit
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter returns a limiter for qps queries per second or nil if qps is not positive
+func newRateLimiter(qps float64) *rateLimiter {
+	if qps <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / qps)}
+}
+
+// wait blocks until the next query may be sent
+func (l *rateLimiter) wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// limits keeps measure from overloading resolvers and name servers.
+// Zero values do not limit.
+type limits struct {
+	global       *rateLimiter
+	serverQPS    float64
+	zoneInflight int
+
+	mu      sync.Mutex
+	servers map[string]*rateLimiter
+	zones   map[string]chan struct{}
+}
+
+// queryLimits applies to all queries sent, measure sets it from the command line
+var queryLimits = newLimits(0, 0, 0)
+
+// newLimits returns limits of qps queries per second in total, serverQPS
+// queries per second to every server and zoneInflight queries in flight for every zone.
+func newLimits(qps float64, serverQPS float64, zoneInflight int) *limits {
+	return &limits{
+		global:       newRateLimiter(qps),
+		serverQPS:    serverQPS,
+		zoneInflight: zoneInflight,
+		servers:      make(map[string]*rateLimiter, 0),
+		zones:        make(map[string]chan struct{}, 0),
+	}
+}
+
+// acquire blocks until a query for zone may be sent to server.
+// The returned function must be called when the answer arrived.
+func (l *limits) acquire(zone string, server string) func() {
+	l.mu.Lock()
+	var inflight chan struct{}
+	if l.zoneInflight > 0 {
+		if _, ok := l.zones[zone]; !ok {
+			l.zones[zone] = make(chan struct{}, l.zoneInflight)
+		}
+		inflight = l.zones[zone]
+	}
+	if _, ok := l.servers[server]; !ok {
+		l.servers[server] = newRateLimiter(l.serverQPS)
+	}
+	perServer := l.servers[server]
+	l.mu.Unlock()
+
+	if inflight != nil {
+		inflight <- struct{}{}
+	}
+	perServer.wait()
+	l.global.wait()
+
+	return func() {
+		if inflight != nil {
+			<-inflight
+		}
+	}
+}
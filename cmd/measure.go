@@ -18,12 +18,16 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/sha256"
 	"fmt"
-	"net"
+	"io"
 	"os"
-	"sort"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/miekg/dns"
 
@@ -33,16 +37,12 @@ import (
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
-
-	"crypto/sha256"
+	"github.com/ulrichwisser/dnssectiming/storage"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var measureCmd = &cobra.Command{
-	Use:     "measure [-c <number of concurrent threads>]  -r <resolver ip> <domain list file>",
+	Use:     "measure [-c <number of concurrent threads>]  --resolvers <resolver ip> <domain list file>",
 	Version: "0.0.1a",
 	Short:   "get dnssec data and save to database",
 	Long:    `get dnssec timing information`,
@@ -72,32 +72,88 @@ func init() {
 
 	// define command line arguments
 	measureCmd.Flags().UintP(CONCURRENT, "c", CONCURRENT_DEFAULT, "number of concurrent resolver queries")
-	measureCmd.Flags().StringSliceP(RESOLVERS, "r", []string{}, "resolver ip address (can be given several times)")
-
-	// Use flags for viper values
-	viper.BindPFlags(measureCmd.Flags())
+	measureCmd.Flags().StringSlice(RESOLVERS, []string{}, "resolver ip address (can be given several times)")
+	measureCmd.Flags().Bool(AUTHORITATIVE, false, "query the name servers of every TLD directly instead of resolvers")
+	measureCmd.Flags().Bool(FORCE, false, "measure even if there already is a run today or resume with a different domain list")
+	measureCmd.Flags().Int64(RESUME, 0, "continue an interrupted run, only queries without answer are sent")
+	measureCmd.Flags().Int(COMMIT_ROWS, COMMIT_ROWS_DEFAULT, "commit to the database after this many RR sets")
+	measureCmd.Flags().Duration(COMMIT_INTERVAL, COMMIT_INTERVAL_DEFAULT, "commit to the database at least this often")
+	measureCmd.Flags().Duration(TIMEOUT, TIMEOUT_DEFAULT, "timeout of a single query")
+	measureCmd.Flags().Float64(QPS, 0, "queries per second to all servers together (0 is unlimited)")
+	measureCmd.Flags().Float64(RESOLVER_QPS, 0, "queries per second to every single resolver or name server (0 is unlimited)")
+	measureCmd.Flags().Int(ZONE_INFLIGHT, 0, "queries in flight for the same TLD (0 is unlimited)")
+	measureCmd.Flags().String(TARGETS, "", "file with one target per line: owner name pattern and RR types, like nic.<tld> A AAAA")
+	measureCmd.Flags().String(ROOTZONE, "", "root zone file with NS and glue records of all TLD (for --authoritative, otherwise name servers are looked up using the resolvers, name servers without glue too)")
 }
 
 func measureRun(args []string) {
 
-	// check resolver list
-	resolvers := getResolvers()
-	log.Debugf("Using resolvers %v", resolvers)
+	// check resolver list or get name servers of all TLD
+	var resolvers []server
+	var nameservers, glueless map[string][]string
+	if viper.GetBool(AUTHORITATIVE) && viper.GetString(ROOTZONE) != "" {
+		var err error
+		nameservers, glueless, err = readRootZone(viper.GetString(ROOTZONE))
+		if err != nil {
+			log.Fatalf("Could not read root zone %s", err)
+		}
+		log.Debugf("Found name servers for %d TLD, %d TLD have name servers without glue", len(nameservers), len(glueless))
+		// name servers without glue are looked up using the resolvers, if given
+		if len(viper.GetStringSlice(RESOLVERS)) > 0 {
+			resolvers = getResolvers()
+			log.Debugf("Using resolvers %v for name servers without glue", resolvers)
+		}
+	} else {
+		resolvers = getResolvers()
+		log.Debugf("Using resolvers %v", resolvers)
+	}
+
+	// owner names and RR types to query for every TLD
+	targets := getTargets()
+	log.Debugf("Using %d targets", len(targets))
 
-	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
+	// be polite to resolvers and name servers
+	if viper.GetDuration(TIMEOUT) <= 0 {
+		log.Fatalf("Timeout must be positive, not %s", viper.GetDuration(TIMEOUT))
 	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
+	if viper.GetFloat64(QPS) < 0 || viper.GetFloat64(RESOLVER_QPS) < 0 || viper.GetInt(ZONE_INFLIGHT) < 0 {
+		log.Fatal("Rate limits must not be negative")
 	}
-	defer db.Close()
-	err = db.Ping()
+	queryLimits = newLimits(viper.GetFloat64(QPS), viper.GetFloat64(RESOLVER_QPS), viper.GetInt(ZONE_INFLIGHT))
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// refuse to write into an outdated schema
+	checkSchema(store)
+
+	// analysis expects one sample per day
+	runs, err := store.Runs()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	log.Debug("DB OPEN")
+	var resume *storage.Run
+	if id := viper.GetInt64(RESUME); id != 0 {
+		for i := range runs {
+			if runs[i].ID == id {
+				resume = &runs[i]
+			}
+		}
+		if resume == nil {
+			log.Fatalf("Run %d does not exist.", id)
+		}
+		if !resume.Partial() {
+			log.Fatalf("Run %d is complete.", id)
+		}
+	} else {
+		today := normalizeDay(time.Now().UTC())
+		for _, run := range runs {
+			if normalizeDay(run.Started.UTC()).Equal(today) && !viper.GetBool(FORCE) {
+				log.Fatalf("Already measured today (run %d). Use --force to measure again or --resume to complete it.", run.ID)
+			}
+		}
+	}
 
 	//
 	// DOMAIN LIST
@@ -117,21 +173,70 @@ func measureRun(args []string) {
 		domainlistfh = os.Stdin
 	}
 
-	scanner := bufio.NewScanner(domainlistfh)
+	// the hash of the domain list is saved with the run
+	input, err := io.ReadAll(domainlistfh)
+	if err != nil {
+		log.Fatalf("Failed to read domain list: %s", err.Error())
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(input))
 	scanner.Split(bufio.ScanLines)
 
+	// start run or continue an interrupted run
+	var run storage.Run
+	var done map[storage.Checkpoint]bool = make(map[storage.Checkpoint]bool, 0)
+	inputHash := fmt.Sprintf("%x", sha256.Sum256(input))
+	if resume != nil {
+		run = *resume
+		if run.InputHash != inputHash && !viper.GetBool(FORCE) {
+			log.Fatalf("Domain list differs from the one of run %d. Use --force to resume anyway.", run.ID)
+		}
+		checkpoints, err := store.Checkpoints(run.ID)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		done = resumeRun(&run, checkpoints)
+		log.Debugf("Resuming run %d, %d queries are done", run.ID, len(done))
+	} else {
+		run = storage.Run{Started: time.Now(), InputHash: inputHash}
+		for _, resolver := range resolvers {
+			run.Resolvers = append(run.Resolvers, resolver.String())
+		}
+		run.ID, err = store.StartRun(run)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		log.Debugf("Started run %d", run.ID)
+	}
+
 	// start concurrent resolving
 	var wg sync.WaitGroup
 	var threads = make(chan string, viper.GetInt(CONCURRENT))
-	var answers = make(chan *dns.Msg, 1000)
+	var answers = make(chan *answer, 1000)
 	defer close(threads)
 
 	// start listening for answers
-	go saveAnswers(answers, &wg, db)
+	go saveAnswers(answers, &wg, store, &run)
+
+	// on SIGINT stop reading the domain list, everything resolved so far is saved
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	var interrupted bool
+	stop := func() bool {
+		select {
+		case sig := <-interrupt:
+			log.Warnf("Received %s, saving the answers of running queries", sig)
+			// a second signal terminates immediately
+			signal.Stop(interrupt)
+			interrupted = true
+		default:
+		}
+		return interrupted
+	}
 
 	resolver := 0 // loop over all resolvers
 
-	for scanner.Scan() {
+	for !stop() && scanner.Scan() {
 		domain := scanner.Text()
 		log.Debugf("Read: %s", domain)
 		if err := scanner.Err(); err != nil {
@@ -144,10 +249,70 @@ func measureRun(args []string) {
 		if domain == "" {
 			continue
 		}
-		domain = strings.ToLower(domain)
+		domain = dns.Fqdn(strings.ToLower(domain))
+
+		// query all name servers of the TLD from the root zone without recursion
+		if viper.GetBool(AUTHORITATIVE) && nameservers != nil {
+			servers, ok := nameservers[domain]
+			if !ok {
+				log.Errorf("%-30s: not found in root zone", domain)
+				continue
+			}
+			if names := glueless[domain]; len(names) > 0 {
+				if len(resolvers) > 0 {
+					threads <- "x"
+					wg.Add(1)
+					go func(domain string, servers []string, names []string, resolver server) {
+						defer wg.Done()
+						addresses, err := lookupAddresses(domain, names, resolver)
+						<-threads
+						if err != nil {
+							log.Errorf("%-30s: Could not look up name servers without glue %s (server %s)", domain, err, resolver)
+						}
+						for _, address := range append(append([]string{}, servers...), addresses...) {
+							threads <- "x"
+							wg.Add(1)
+							go resolve(domain, targets, []server{tcpServer(address)}, false, done, &wg, threads, answers)
+						}
+					}(domain, servers, names, resolvers[resolver])
+					resolver = (resolver + 1) % len(resolvers)
+					continue
+				}
+				log.Errorf("%-30s: no glue for %s in root zone, use --resolvers to look them up", domain, strings.Join(names, ","))
+			}
+			for _, address := range servers {
+				threads <- "x"
+				wg.Add(1)
+				go resolve(domain, targets, []server{tcpServer(address)}, false, done, &wg, threads, answers)
+			}
+			continue
+		}
+
+		// look up the name servers of the TLD, then query them without recursion
+		if viper.GetBool(AUTHORITATIVE) {
+			threads <- "x"
+			wg.Add(1)
+			go func(domain string, resolver server) {
+				defer wg.Done()
+				servers, err := lookupNameservers(domain, resolver)
+				<-threads
+				if err != nil {
+					log.Errorf("%-30s: Could not look up name servers %s (server %s)", domain, err, resolver)
+					return
+				}
+				for _, address := range servers {
+					threads <- "x"
+					wg.Add(1)
+					go resolve(domain, targets, []server{tcpServer(address)}, false, done, &wg, threads, answers)
+				}
+			}(domain, resolvers[resolver])
+			resolver = (resolver + 1) % len(resolvers)
+			continue
+		}
+
 		threads <- "x"
 		wg.Add(1)
-		go resolve(dns.Fqdn(domain), resolvers[resolver], &wg, threads, answers)
+		go resolve(domain, targets, failoverOrder(resolvers, resolver), true, done, &wg, threads, answers)
 		resolver = (resolver + 1) % len(resolvers)
 	}
 	wg.Wait()
@@ -156,12 +321,21 @@ func measureRun(args []string) {
 	close(answers)
 	wg.Wait()
 
+	// an interrupted run stays partial
+	if !interrupted {
+		run.Finished = time.Now()
+	}
+	if err := store.FinishRun(run); err != nil {
+		log.Fatal(err.Error())
+	}
+
 	log.Debug("Done reading domain list.")
 }
 
-// getResolvers will read the list of resolvers from /etc/resolv.conf
-func getResolvers() []string {
-	resolvers := make([]string, 0)
+// getResolvers will read the list of resolvers from the command line.
+// Resolvers are IP addresses (queried over TCP) or URIs with transport and port.
+func getResolvers() []server {
+	resolvers := make([]server, 0)
 
 	rslice := viper.GetStringSlice(RESOLVERS)
 	if len(rslice) == 0 {
@@ -169,21 +343,11 @@ func getResolvers() []string {
 	}
 
 	for _, r := range rslice {
-
-		ip := net.ParseIP(r)
-		if ip == nil {
-			log.Fatalf("Could not parse resolver ip: %s", r)
-		}
-
-		ipstr := ip.String()
-		if strings.ContainsAny(":", ipstr) {
-			// IPv6 address
-			ipstr = "[" + ipstr + "]:53"
-		} else {
-			// IPv4 address
-			ipstr = ipstr + ":53"
+		resolver, err := parseServer(r)
+		if err != nil {
+			log.Fatalf("Could not parse resolver %s: %s", r, err)
 		}
-		resolvers = append(resolvers, ipstr)
+		resolvers = append(resolvers, resolver)
 	}
 	if len(resolvers) == 0 {
 		log.Fatal("No resolvers found.")
@@ -191,122 +355,308 @@ func getResolvers() []string {
 	return resolvers
 }
 
-// resolv will send a query and save the result
-func resolve(domain string, server string, wg *sync.WaitGroup, threads <-chan string, answers chan *dns.Msg) {
-	defer log.Trace(fmt.Sprintf("Resolving %s using %s", domain, server)).Stop(nil)
+// answer is a response and the server that sent it.
+// msg is nil if the query failed, outcome tells why.
+type answer struct {
+	msg           *dns.Msg
+	rrtype        uint16
+	outcome       storage.Outcome
+	attempts      []storage.Attempt
+	server        string
+	transport     string
+	domain        string
+	owner         string // see target.owner
+	authoritative bool
+}
+
+// resolv will send a query for every target and save the result
+// If recursive is false servers is one name server of the domain,
+// otherwise failed queries are sent to the next resolver in servers.
+// Queries found in done were answered before and are skipped.
+func resolve(domain string, targets []target, servers []server, recursive bool, done map[storage.Checkpoint]bool, wg *sync.WaitGroup, threads <-chan string, answers chan *answer) {
+	defer log.Trace(fmt.Sprintf("Resolving %s using %s", domain, servers[0])).Stop(nil)
 
 	defer func() { _ = <-threads }()
 	defer wg.Done()
 
 	// Setting up query
 	query := new(dns.Msg)
-	query.RecursionDesired = true
 	query.Question = make([]dns.Question, 1)
 	query.SetEdns0(1232, false)
 	query.IsEdns0().SetDo()
 
-	// Setting up resolver
-	client := new(dns.Client)
-	client.ReadTimeout = TIMEOUT * 1e9
-	client.Net = "tcp"
-
-	for _, rrtype := range []uint16{dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY, dns.TypeDS} {
-		query.SetQuestion(domain, rrtype)
-
-		// limit repeats
-		var repeat int = 0
-		// query until we get an answer
-		for {
-
-			// limit repeats
-			repeat++
-			log.Debugf("%-30s: %d repeats reached (server %s, %s)", domain, repeat, server, dns.TypeToString[rrtype])
-			if repeat > 10 {
-				log.Errorf("%-30s: 10 repeats reached (server %s)", domain, server)
-				break
-			}
-
-			// make the query and wait for answer
-			r, _, err := client.Exchange(query, server)
-
-			// check for errors
-			if err != nil {
-				log.Errorf("%-30s: Error resolving %s (server %s)", domain, err, server)
-				continue
-			}
-			if r == nil {
-				log.Errorf("%-30s: No answer (Server %s)", domain, server)
-				continue
-			}
-			if r.Rcode != dns.RcodeSuccess {
-				log.Errorf("%-30s: %s (Rcode %d, Server %s)", domain, dns.RcodeToString[r.Rcode], r.Rcode, server)
-				break
-			}
+	for _, t := range targets {
+		if !recursive && t.pattern == TARGET_TLD && t.rrtype == dns.TypeDS {
+			// DS is served by the parent, not by the name servers of the domain
+			continue
+		}
+		owner := t.owner(domain)
+		if done[checkpointOf(domain, owner, t.rrtype, servers[0].address, !recursive)] {
+			continue
+		}
+		query.SetQuestion(queryName(domain, owner), t.rrtype)
+		// SetQuestion asks for recursion, name servers are queried without
+		query.RecursionDesired = recursive
 
-			// we got an answer
-			answers <- r
-			break
+		r, server, outcome, attempts := exchange(query, domain, servers)
+		if !outcome.Answered() {
+			r = nil
 		}
+		answers <- &answer{msg: r, rrtype: t.rrtype, outcome: outcome, attempts: attempts, server: server.address, transport: server.transport, domain: domain, owner: owner, authoritative: !recursive}
 	}
 }
 
-func saveAnswers(answers chan *dns.Msg, wg *sync.WaitGroup, db *sql.DB) {
+// saveAnswers saves all answers as observations of the run and counts
+// the successful and failed queries per RR type in run.Counts.
+// Observations are committed in batches, everything is committed when answers is closed.
+func saveAnswers(answers chan *answer, wg *sync.WaitGroup, store storage.Store, run *storage.Run) {
 	var err error
 	defer log.Trace("saving answers").Stop(nil)
 
-	tx, err := db.Begin()
-	if err != nil {
-		log.Fatalf("Could not start DB transaction %s", err)
+	// a resumed run continues counting
+	if run.Counts == nil {
+		run.Counts = make(map[uint16]storage.RunCount, 0)
+	}
+	count := func(rrtype uint16, success bool) {
+		c := run.Counts[rrtype]
+		if success {
+			c.Success++
+		} else {
+			c.Failure++
+		}
+		run.Counts[rrtype] = c
 	}
-	defer tx.Rollback()
 
-	stmt_rrdata, err := tx.Prepare("INSERT IGNORE INTO RRDATA(SHA256,RRDATA) VALUES(?,?)")
-	if err != nil {
-		log.Fatalf("Could not prepare insert into rrdata %s", err)
+	// commit every COMMIT_ROWS observations or COMMIT_INTERVAL
+	writer := storage.NewWriter(store, viper.GetInt(COMMIT_ROWS))
+
+	// every query sent is saved, the last attempt has the final outcome
+	saveAttempts := func(a *answer, outcome storage.Outcome) {
+		for i, attempt := range a.attempts {
+			attempt.Run = run.ID
+			attempt.Authoritative = a.authoritative
+			attempt.Owner = a.owner
+			if i == len(a.attempts)-1 {
+				attempt.Outcome = outcome
+			}
+			if err := writer.Attempt(attempt); err != nil {
+				log.Fatal(err.Error())
+			}
+		}
 	}
-	defer stmt_rrdata.Close() // Prepared statements take up server resources and should be closed after use.
 
-	stmt_rrsig, err := tx.Prepare("INSERT INTO RRSIG(TLD,RRTYPE,SHA256,INCEPTION,EXPIRATION,SIG) VALUES(?,?,?,from_unixtime(?),from_unixtime(?),?)")
-	if err != nil {
-		log.Fatalf("Could not prepare insert into rrsig %s", err)
+	// queries without observation are saved as checkpoints only, with their outcome
+	checkpoint := func(a *answer, outcome storage.Outcome) {
+		saveAttempts(a, outcome)
+		c := checkpointOf(a.domain, a.owner, a.rrtype, a.server, a.authoritative)
+		c.Run = run.ID
+		c.Outcome = outcome
+		if err := writer.Checkpoint(c); err != nil {
+			log.Fatal(err.Error())
+		}
 	}
-	defer stmt_rrsig.Close() // Prepared statements take up server resources and should be closed after use.
+	ticker := time.NewTicker(viper.GetDuration(COMMIT_INTERVAL))
+	defer ticker.Stop()
+
+	for {
+		var a *answer
+		var ok bool
+		select {
+		case <-ticker.C:
+			if err := writer.Flush(); err != nil {
+				log.Fatal(err.Error())
+			}
+			continue
+		case a, ok = <-answers:
+		}
+		if !ok {
+			break
+		}
 
-	for msg := range answers {
+		msg := a.msg
+		if msg == nil {
+			count(a.rrtype, false)
+			checkpoint(a, a.outcome)
+			continue
+		}
 
-		var rrsig *dns.RRSIG
-		var rrdata []string
+		// save one signed RR set, outcome is the outcome of the query
+		write := func(owner string, rrtype uint16, rrdata []dns.RR, rrsigs []*dns.RRSIG, outcome storage.Outcome) {
+			// the TTL in the answer is the remaining cache TTL of the resolver,
+			// RRDATA is saved with the original TTL to be comparable between runs
+			var origTTL uint32
+			for _, rrsig := range rrsigs {
+				if rrsig.OrigTtl > origTTL {
+					origTTL = rrsig.OrigTtl
+				}
+			}
+			rrdata_str := storage.NormalizeRRSet(rrdata, origTTL)
+
+			o := storage.Observation{
+				Resolved:   time.Now(),
+				TLD:        a.domain,
+				Owner:      owner,
+				RRType:     rrtype,
+				RRData:     rrdata_str,
+				TTL:        rrdata[0].Header().Ttl,
+				Signatures: rrsigs,
+
+				Server:        a.server,
+				Transport:     a.transport,
+				Authoritative: a.authoritative,
+				Run:           run.ID,
+			}
+			if rrtype != a.rrtype {
+				o.QueryType = a.rrtype
+			}
+			// only the proofs of negative answers are saved with another outcome
+			if outcome != storage.OutcomeOK {
+				o.Outcome = outcome
+				o.Proof = true
+				o.QueryOwner = a.owner
+			}
+			if err := writer.Write(o); err != nil {
+				log.Fatal(err.Error())
+			}
+			fmt.Println(rrdata_str)
+		}
+
+		// targets below the apex may be aliases, only the queried type is saved
+		var rrsigs []*dns.RRSIG
+		var rrdata []dns.RR
 		for _, rr := range msg.Answer {
 			if rr.Header().Rrtype == dns.TypeRRSIG {
-				if rrsig == nil || rr.(*dns.RRSIG).Expiration > rrsig.Expiration {
-					rrsig = rr.(*dns.RRSIG)
+				// keep all signatures, during rollovers there is more than one
+				if rr.(*dns.RRSIG).TypeCovered == msg.Question[0].Qtype {
+					rrsigs = append(rrsigs, rr.(*dns.RRSIG))
 				}
-			} else {
-				rrdata = append(rrdata, rr.String())
+			} else if rr.Header().Rrtype == msg.Question[0].Qtype {
+				rrdata = append(rrdata, rr)
+			}
+		}
+
+		// negative answers are proven by the signed RR sets of the authority section
+		if a.outcome == storage.OutcomeNXDomain || len(rrdata) == 0 {
+			outcome := storage.OutcomeNoData
+			if a.outcome == storage.OutcomeNXDomain {
+				outcome = storage.OutcomeNXDomain
+			}
+			proofs := denialProofs(msg)
+			if len(proofs) == 0 {
+				log.Infof("%s %s %s is not signed. ", msg.Question[0].Name, dns.TypeToString[msg.Question[0].Qtype], outcome)
+				count(a.rrtype, false)
+				checkpoint(a, outcome)
+				continue
+			}
+			saveAttempts(a, outcome)
+			for _, proof := range proofs {
+				write(proofOwner(a.domain, proof.owner), proof.rrtype, proof.rrdata, proof.rrsigs, outcome)
 			}
+			count(a.rrtype, true)
+			continue
 		}
-		if rrsig == nil {
+		if len(rrsigs) == 0 {
 			log.Infof("%s %s is not signed. ", msg.Question[0].Name, dns.TypeToString[msg.Question[0].Qtype])
+			count(a.rrtype, false)
+			checkpoint(a, storage.OutcomeUnsigned)
 			continue
 		}
-		sort.Strings(rrdata) // sort is need to normalize strings, dns answers with round robin data
-		rrdata_str := strings.Join(rrdata, "\n")
-		sha256 := fmt.Sprintf("%x", sha256.Sum256([]byte(rrdata_str)))
 
-		_, err = stmt_rrdata.Exec(sha256, rrdata_str)
-		if err != nil {
-			log.Fatalf("Writing to RRDATA failed %s", err)
+		saveAttempts(a, storage.OutcomeOK)
+		write(a.owner, a.rrtype, rrdata, rrsigs, storage.OutcomeOK)
+		count(a.rrtype, true)
+	}
+	err = writer.Flush()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	wg.Done()
+}
+
+// resumeRun returns the queries of an interrupted run that were answered.
+// All other queries are sent again, the failures counted for them are taken
+// out of run.Counts, so that every query is counted once with its final outcome.
+func resumeRun(run *storage.Run, checkpoints []storage.Checkpoint) map[storage.Checkpoint]bool {
+	var done map[storage.Checkpoint]bool = make(map[storage.Checkpoint]bool, 0)
+	for _, c := range checkpoints {
+		if !c.Outcome.Answered() {
+			// counts are only saved when measure ends, a killed run has none
+			if count, ok := run.Counts[c.RRType]; ok && count.Failure > 0 {
+				count.Failure--
+				run.Counts[c.RRType] = count
+			}
+			continue
 		}
+		c.Run = 0
+		c.Outcome = ""
+		done[c] = true
+	}
+	return done
+}
 
-		_, err = stmt_rrsig.Exec(msg.Question[0].Name, msg.Question[0].Qtype, sha256, rrsig.Inception, rrsig.Expiration, "")
-		if err != nil {
-			log.Fatalf("Writing to RRSIG failed %s", err)
+// checkpointOf returns the checkpoint of a query without run.
+// Queries to resolvers are the same whichever resolver was used.
+func checkpointOf(domain string, owner string, rrtype uint16, server string, authoritative bool) storage.Checkpoint {
+	c := storage.Checkpoint{TLD: domain, Owner: owner, RRType: rrtype}
+	if authoritative {
+		c.Server = server
+	}
+	return c
+}
+
+// signedSet is an RR set of an answer with its signatures
+type signedSet struct {
+	owner  string
+	rrtype uint16
+	rrdata []dns.RR
+	rrsigs []*dns.RRSIG
+}
+
+// denialProofs returns the signed NSEC, NSEC3 and SOA RR sets of the authority
+// section of a negative answer in the order of the answer.
+func denialProofs(msg *dns.Msg) []signedSet {
+	type setKey struct {
+		name   string
+		rrtype uint16
+	}
+	var sets []signedSet
+	var index map[setKey]int = make(map[setKey]int, 0)
+	get := func(name string, rrtype uint16) *signedSet {
+		key := setKey{strings.ToLower(name), rrtype}
+		if _, ok := index[key]; !ok {
+			index[key] = len(sets)
+			sets = append(sets, signedSet{owner: key.name, rrtype: rrtype})
 		}
-		fmt.Println(rrdata_str)
+		return &sets[index[key]]
 	}
-	err = tx.Commit()
-	if err != nil {
-		log.Fatalf("Could not prepare commit to DB %s", err)
+	for _, rr := range msg.Ns {
+		switch rr := rr.(type) {
+		case *dns.NSEC, *dns.NSEC3, *dns.SOA:
+			set := get(rr.Header().Name, rr.Header().Rrtype)
+			set.rrdata = append(set.rrdata, rr)
+		case *dns.RRSIG:
+			switch rr.TypeCovered {
+			case dns.TypeNSEC, dns.TypeNSEC3, dns.TypeSOA:
+				set := get(rr.Header().Name, rr.TypeCovered)
+				set.rrsigs = append(set.rrsigs, rr)
+			}
+		}
 	}
-	wg.Done()
+
+	var proofs []signedSet
+	for _, set := range sets {
+		if len(set.rrdata) > 0 && len(set.rrsigs) > 0 {
+			proofs = append(proofs, set)
+		}
+	}
+	return proofs
+}
+
+// proofOwner returns the owner name of a proof as saved, empty for the TLD itself
+func proofOwner(domain string, name string) string {
+	name = strings.ToLower(dns.Fqdn(name))
+	if name == strings.ToLower(dns.Fqdn(domain)) {
+		return ""
+	}
+	return name
 }
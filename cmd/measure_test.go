@@ -0,0 +1,180 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/viper"
+
+	"github.com/ulrichwisser/dnssectiming/schema"
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// testServer answers every query with NXDOMAIN and sends the queries it received to queries
+func testServer(t *testing.T) (server, <-chan *dns.Msg) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	queries := make(chan *dns.Msg, 10)
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		queries <- r.Copy()
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	srv := &dns.Server{PacketConn: conn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go srv.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { srv.Shutdown() })
+	return server{transport: TRANSPORT_UDP, address: conn.LocalAddr().String()}, queries
+}
+
+func TestResolveRecursionDesired(t *testing.T) {
+	for _, recursive := range []bool{true, false} {
+		srv, queries := testServer(t)
+		var wg sync.WaitGroup
+		threads := make(chan string, 1)
+		answers := make(chan *answer, 10)
+
+		threads <- "se."
+		wg.Add(1)
+		resolve("se.", []target{{TARGET_TLD, dns.TypeSOA}}, []server{srv}, recursive, nil, &wg, threads, answers)
+		wg.Wait()
+
+		select {
+		case q := <-queries:
+			if q.RecursionDesired != recursive {
+				t.Errorf("recursive %v: query sent with RD=%v", recursive, q.RecursionDesired)
+			}
+			if !q.IsEdns0().Do() {
+				t.Errorf("recursive %v: query sent without DO", recursive)
+			}
+		default:
+			t.Fatalf("recursive %v: no query sent", recursive)
+		}
+		if a := <-answers; a.outcome != storage.OutcomeNXDomain {
+			t.Errorf("recursive %v: got outcome %s", recursive, a.outcome)
+		}
+	}
+}
+
+// signedAnswer returns a signed answer of se. for the RR type
+func signedAnswer(t *testing.T, rrtype uint16, rdata string) *answer {
+	t.Helper()
+	rr, err := dns.NewRR("se. 3600 IN " + dns.TypeToString[rrtype] + " " + rdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	rrsig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: "se.", Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		TypeCovered: rrtype,
+		Algorithm:   dns.ECDSAP256SHA256,
+		Labels:      1,
+		OrigTtl:     3600,
+		Expiration:  uint32(now.Add(24 * time.Hour).Unix()),
+		Inception:   uint32(now.Add(-time.Hour).Unix()),
+		KeyTag:      12345,
+		SignerName:  "se.",
+		Signature:   "c2lnbmF0dXJl",
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion("se.", rrtype)
+	msg.Answer = []dns.RR{rr, rrsig}
+	return &answer{msg: msg, rrtype: rrtype, outcome: storage.OutcomeOK, server: "192.0.2.1:53", transport: TRANSPORT_TCP, domain: "se."}
+}
+
+// save runs saveAnswers for the answers and saves the counts of the run
+func save(t *testing.T, store storage.Store, run *storage.Run, list ...*answer) {
+	t.Helper()
+	var wg sync.WaitGroup
+	answers := make(chan *answer, len(list))
+	go saveAnswers(answers, &wg, store, run)
+	for _, a := range list {
+		answers <- a
+	}
+	wg.Add(1)
+	close(answers)
+	wg.Wait()
+	if err := store.FinishRun(*run); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestResumeCounts(t *testing.T) {
+	rows, interval := viper.GetInt(COMMIT_ROWS), viper.GetDuration(COMMIT_INTERVAL)
+	viper.Set(COMMIT_ROWS, 10)
+	viper.Set(COMMIT_INTERVAL, time.Minute)
+	defer func() {
+		viper.Set(COMMIT_ROWS, rows)
+		viper.Set(COMMIT_INTERVAL, interval)
+	}()
+
+	store, err := storage.Open("sqlite://" + filepath.Join(t.TempDir(), "dnssectiming.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := schema.Migrate(store.DB(), store.Dialect()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the DNSKEY query times out, the run is interrupted
+	run := storage.Run{Started: time.Now()}
+	if run.ID, err = store.StartRun(run); err != nil {
+		t.Fatal(err)
+	}
+	timeout := &answer{rrtype: dns.TypeDNSKEY, outcome: storage.OutcomeTimeout, server: "192.0.2.1:53", transport: TRANSPORT_TCP, domain: "se."}
+	save(t, store, &run, signedAnswer(t, dns.TypeSOA, "ns1.se. hostmaster.se. 2024010101 1800 900 1209600 3600"), timeout)
+
+	// resume sends the DNSKEY query again
+	runs, err := store.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := runs[0]
+	checkpoints, err := store.Checkpoints(resumed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := resumeRun(&resumed, checkpoints)
+	if len(done) != 1 || !done[storage.Checkpoint{TLD: "se.", RRType: dns.TypeSOA}] {
+		t.Errorf("got done %v, want SOA", done)
+	}
+	save(t, store, &resumed, signedAnswer(t, dns.TypeDNSKEY, "257 3 13 c2lnbmF0dXJl"))
+
+	runs, err = store.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint16]storage.RunCount{dns.TypeSOA: {Success: 1}, dns.TypeDNSKEY: {Success: 1}}
+	for rrtype, count := range want {
+		if runs[0].Counts[rrtype] != count {
+			t.Errorf("%s: got counts %+v, want %+v", dns.TypeToString[rrtype], runs[0].Counts[rrtype], count)
+		}
+	}
+}
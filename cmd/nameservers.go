@@ -0,0 +1,92 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// lookupNameservers asks a resolver for the NS set of a domain and
+// returns the IPv4 and IPv6 addresses of all name servers.
+func lookupNameservers(domain string, resolver server) ([]string, error) {
+	nsSet, err := lookupRRs(domain, domain, dns.TypeNS, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range nsSet {
+		if ns, ok := rr.(*dns.NS); ok {
+			names = append(names, ns.Ns)
+		}
+	}
+	servers, err := lookupAddresses(domain, names, resolver)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no name server addresses found for %s", domain)
+	}
+	return servers, nil
+}
+
+// lookupAddresses asks a resolver for the IPv4 and IPv6 addresses of the name servers of a domain.
+// The addresses found are returned even if some lookups failed.
+func lookupAddresses(domain string, names []string, resolver server) ([]string, error) {
+	var servers []string
+	var lastErr error
+	for _, name := range names {
+		for _, rrtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			addresses, err := lookupRRs(domain, name, rrtype, resolver)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, rr := range addresses {
+				switch rr := rr.(type) {
+				case *dns.A:
+					servers = append(servers, serverAddress(rr.A))
+				case *dns.AAAA:
+					servers = append(servers, serverAddress(rr.AAAA))
+				}
+			}
+		}
+	}
+	sort.Strings(servers)
+	return servers, lastErr
+}
+
+// lookupRRs asks a resolver for one RR set, queries count against the limits of domain
+func lookupRRs(domain string, name string, rrtype uint16, resolver server) ([]dns.RR, error) {
+	query := new(dns.Msg)
+	query.SetQuestion(name, rrtype)
+	query.RecursionDesired = true
+	query.SetEdns0(1232, false)
+	release := queryLimits.acquire(domain, resolver.address)
+	r, err := resolver.exchange(query)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("%s %s: %s", name, dns.TypeToString[rrtype], dns.RcodeToString[r.Rcode])
+	}
+	return r.Answer, nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// nsec3Cmd lists the NSEC3 parameters of all TLD per day
+var nsec3Cmd = &cobra.Command{
+	Use:     "nsec3 [--tld <name>]",
+	Version: "0.0.1a",
+	Short:   "list the NSEC3 parameters of all TLD per day",
+	Long: `list the NSEC3 parameters of all TLD per day
+
+The parameters are taken from the denial of existence of random names.
+RFC 9276 recommends 0 additional iterations and no salt.
+
+Output columns: date tld hash optout iterations salt`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		nsec3Run(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(nsec3Cmd)
+
+	// define command line arguments
+	addRunFlags(nsec3Cmd)
+}
+
+func nsec3Run(args []string) {
+
+	// check TLD command line argument, list all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	params, err := store.NSEC3Params(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	// one line for every parameter set seen on a day
+	type nsec3Key struct {
+		day        time.Time
+		tld        string
+		hash       uint8
+		optOut     bool
+		iterations uint16
+		salt       string
+	}
+	var seen map[nsec3Key]bool = make(map[nsec3Key]bool, 0)
+	var keys []nsec3Key
+	var iterations, salted map[string]bool = make(map[string]bool, 0), make(map[string]bool, 0)
+	var tlds map[string]bool = make(map[string]bool, 0)
+	for _, p := range params {
+		key := nsec3Key{normalizeDay(p.Resolved.UTC()), p.TLD, p.Hash, p.OptOut, p.Iterations, p.Salt}
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		tlds[p.TLD] = true
+		if p.Iterations > 0 {
+			iterations[p.TLD] = true
+		}
+		if p.Salt != "" {
+			salted[p.TLD] = true
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if !keys[i].day.Equal(keys[j].day) {
+			return keys[i].day.Before(keys[j].day)
+		}
+		return keys[i].tld < keys[j].tld
+	})
+
+	fmt.Println("# date tld hash optout iterations salt")
+	for _, key := range keys {
+		salt := key.salt
+		if salt == "" {
+			salt = "-"
+		}
+		fmt.Printf("%s %s %d %v %d %s\n", key.day.Format(time.DateOnly), key.tld, key.hash, key.optOut, key.iterations, salt)
+	}
+	fmt.Printf("# %d TLD use NSEC3, %d with additional iterations, %d with salt\n", len(tlds), len(iterations), len(salted))
+}
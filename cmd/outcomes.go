@@ -0,0 +1,145 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// outcomesCmd counts the final outcome of all queries per day
+var outcomesCmd = &cobra.Command{
+	Use:     "outcomes [--tld <name>] [--rr <type>[,<type>...]]",
+	Version: "0.0.1a",
+	Short:   "count the outcome of all queries per day",
+	Long: `count the outcome of all queries per day
+
+The outcome of a query is the outcome of its last attempt, after all retries
+and all resolvers. This tells apart TLD that went unsigned (unsigned), resolvers
+that failed to validate (servfail) and queries that did not reach any server
+(timeout, network).
+
+Output columns: date [type] ok unsigned nodata nxdomain servfail refused rcode truncated timeout network`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		outcomesRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(outcomesCmd)
+
+	// define command line arguments
+	addRunFlags(outcomesCmd)
+}
+
+// allOutcomes is the order of the output columns
+var allOutcomes = []storage.Outcome{
+	storage.OutcomeOK,
+	storage.OutcomeUnsigned,
+	storage.OutcomeNoData,
+	storage.OutcomeNXDomain,
+	storage.OutcomeServfail,
+	storage.OutcomeRefused,
+	storage.OutcomeRcode,
+	storage.OutcomeTruncated,
+	storage.OutcomeTimeout,
+	storage.OutcomeNetwork,
+}
+
+func outcomesRun(args []string) {
+
+	// check TLD command line argument, count all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, count all types if not given
+	rrtypes := getRRTypes(false)
+	filter.RRTypes = rrtypes
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	attempts, err := store.Attempts(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	outcomesByDay := finalOutcomes(attempts, rrtypes)
+
+	var days []dateKey
+	for day := range outcomesByDay {
+		days = append(days, day)
+	}
+	sortDateKeys(days)
+
+	var header []string
+	for _, outcome := range allOutcomes {
+		header = append(header, string(outcome))
+	}
+	fmt.Printf("# date%s %s\n", rrtypeHeader(rrtypes), strings.Join(header, " "))
+	for _, day := range days {
+		var counts []string
+		for _, outcome := range allOutcomes {
+			counts = append(counts, fmt.Sprintf("%d", outcomesByDay[day][outcome]))
+		}
+		fmt.Printf("%s%s %s\n", day.date.Format(time.DateOnly), rrtypeColumn(rrtypes, day.rrtype), strings.Join(counts, " "))
+	}
+}
+
+// finalOutcomes counts the final outcome of every query per day, and per RR type
+// if more than one type was asked for.
+// Attempts must be ordered by send time, the last attempt of a query is final.
+func finalOutcomes(attempts []storage.Attempt, rrtypes []uint16) map[dateKey]map[storage.Outcome]int {
+	var final map[storage.Checkpoint]storage.Attempt = make(map[storage.Checkpoint]storage.Attempt, 0)
+	for _, attempt := range attempts {
+		query := attempt.Checkpoint()
+		query.Outcome = ""
+		final[query] = attempt
+	}
+
+	var outcomesByDay map[dateKey]map[storage.Outcome]int = make(map[dateKey]map[storage.Outcome]int, 0)
+	for _, attempt := range final {
+		day := dateKeyOf(rrtypes, normalizeDay(attempt.Sent.UTC()), attempt.RRType)
+		if _, ok := outcomesByDay[day]; !ok {
+			outcomesByDay[day] = make(map[storage.Outcome]int, 0)
+		}
+		outcomesByDay[day][attempt.Outcome]++
+	}
+	return outcomesByDay
+}
@@ -18,25 +18,20 @@ package cmd
 
 import (
 	"fmt"
-	"sort"
 	"time"
 
-	"github.com/miekg/dns"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ulrichwisser/dnssectiming/storage"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var remainingCmd = &cobra.Command{
-	Use:     "remaining --rr <NS|DNSKEY>",
+	Use:     "remaining --rr <type>[,<type>...]",
 	Version: "0.0.1a",
 	Short:   "get DNSSEC timing data for rr type",
 	Long:    "get DNSSEC timing data for rr type",
@@ -62,46 +57,36 @@ var remainingCmd = &cobra.Command{
 func init() {
 	// add the command to cobra
 	rootCmd.AddCommand(remainingCmd)
+
+	// define command line arguments
+	addRunFlags(remainingCmd)
+	addSelectFlag(remainingCmd)
+	addAllOwnersFlag(remainingCmd)
 }
 
 func remainingRun(args []string) {
 
 	// check RR command line arguments
-	var rrtype uint16 = 0
-	var rr_str = viper.GetString(RR)
-	if rr_str == "NS" {
-		rrtype = dns.TypeNS
-	}
-	if rr_str == "DNSKEY" {
-		rrtype = dns.TypeDNSKEY
-	}
-	if rrtype == 0 {
-		log.Fatal("No valid RR type was given. Must be one of NS or DNSKEY")
-	}
+	rrtypes := getRRTypes(true)
+
+	// check select command line argument
+	sel := getSelect()
 
 	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
-	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Could not ping DB %s", err.Error())
-	}
-	log.Debug("DB OPEN")
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	runs := getRuns(store)
 
 	//
 	// Get lifetime
 	//
-	rrData, err := db.Query("SELECT RESOLVED,TLD,EXPIRATION FROM RRSIG WHERE RRTYPE=? ORDER BY RESOLVED,TLD ", rrtype)
+	rrData, err := store.Signatures(storage.Filter{RRTypes: rrtypes, Runs: runs, AllOwners: viper.GetBool(ALL_OWNERS)})
 	if err != nil {
-		log.Fatalf("Could not query for %s data %s", rr_str, err)
+		log.Fatal(err.Error())
 	}
-	defer rrData.Close() // Prepared statements take up server resources and should be closed after use.
+	rrData = selectSignatures(rrData, sel)
 
 	//
 	const under1d int64 = 86400
@@ -110,48 +95,45 @@ func remainingRun(args []string) {
 	const under14d int64 = 1209600
 	const under35d int64 = 3024000
 
-	var remaining map[time.Time]map[int64]uint = make(map[time.Time]map[int64]uint, 0)
+	var remaining map[dateKey]map[int64]uint = make(map[dateKey]map[int64]uint, 0)
 		
-	for rrData.Next() {
-		var resolved time.Time
-		var tld string
-		var expiration time.Time
-		err := rrData.Scan(&resolved, &tld, &expiration)
-		if err != nil {
-			log.Fatalf("Error scanning RR data. %s", err)
-		}
-		lifetime := expiration.UTC().Unix() - resolved.UTC().Unix()
+	for _, sig := range rrData {
+		resolved := sig.Resolved
+		tld := sig.TLD
+		expiration := sig.Expiration
+		lifetime := sig.Lifetime()
 		if lifetime < 0{
 			// Signature too old, no meaningful statistic can be extracted
 			continue
 		}
 
 		// prepare data structure
-		if _, ok := remaining[resolved]; !ok {
-			remaining[resolved] = make(map[int64]uint, 0)
+		key := dateKeyOf(rrtypes, resolved, sig.RRType)
+		if _, ok := remaining[key]; !ok {
+			remaining[key] = make(map[int64]uint, 0)
 		}
 
 		// save data
 		switch {
-		case lifetime <under1d: remaining[resolved][under1d] += 1
+		case lifetime <under1d: remaining[key][under1d] += 1
 								 log.Infof("TLD %s Lifetime %d (expiration %s (%d), resolved %s (%d))\n",tld,lifetime,expiration.Format(time.DateTime),expiration.UTC().Unix(), resolved.Format(time.DateTime),resolved.UTC().Unix())	
-		case lifetime <under3d: remaining[resolved][under3d] += 1
-		case lifetime <under7d: remaining[resolved][under7d] += 1
-		case lifetime <under14d: remaining[resolved][under14d] += 1
-		case lifetime <under35d: remaining[resolved][under35d] += 1
+		case lifetime <under3d: remaining[key][under3d] += 1
+		case lifetime <under7d: remaining[key][under7d] += 1
+		case lifetime <under14d: remaining[key][under14d] += 1
+		case lifetime <under35d: remaining[key][under35d] += 1
 		}
 	}
 
 	// get sorted lists of resolved
-	var resolvedList []time.Time
-	for resolved := range remaining {
-		resolvedList = append(resolvedList, resolved)
+	var resolvedList []dateKey
+	for key := range remaining {
+		resolvedList = append(resolvedList, key)
 	}
-	sort.Slice(resolvedList, func(i, j int) bool { return resolvedList[i].Before(resolvedList[j]) })
+	sortDateKeys(resolvedList)
 
 	// output final result
-	for _, resolved := range resolvedList {
-		fmt.Printf("%s %d %d %d %d %d\n", resolved.Format(time.DateOnly), remaining[resolved][under1d], remaining[resolved][under3d], remaining[resolved][under7d], remaining[resolved][under14d], remaining[resolved][under35d])
+	for _, key := range resolvedList {
+		fmt.Printf("%s%s %d %d %d %d %d\n", key.date.Format(time.DateOnly), rrtypeColumn(rrtypes, key.rrtype), remaining[key][under1d], remaining[key][under3d], remaining[key][under7d], remaining[key][under14d], remaining[key][under35d])
 	}
 
 }
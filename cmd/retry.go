@@ -0,0 +1,140 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+func init() {
+	// jitter must differ between runs
+	rand.Seed(time.Now().UnixNano())
+}
+
+// exchange sends the query to the servers in order until one answers.
+// Timeouts and network errors are retried on the same server with jittered
+// exponential backoff. Truncated UDP answers are repeated over TCP.
+// SERVFAIL, REFUSED, truncated TCP answers and other errors move on to the
+// next server at once. NXDOMAIN is a final answer.
+// Every query waits for the rate limits of the zone and the server.
+// The last answer (nil if there was none), the server that sent it with the
+// transport used, the outcome and all attempts are returned.
+func exchange(query *dns.Msg, zone string, servers []server) (*dns.Msg, server, storage.Outcome, []storage.Attempt) {
+	var r *dns.Msg
+	var used server
+	var outcome storage.Outcome
+	var attempts []storage.Attempt
+
+	// send the query once and remember the attempt
+	send := func(s server, attempt int) {
+		var err error
+		release := queryLimits.acquire(zone, s.address)
+		sent := time.Now()
+		r, err = s.exchange(query)
+		release()
+		used = s
+		outcome = classify(r, err)
+		a := storage.Attempt{
+			TLD:       zone,
+			RRType:    query.Question[0].Qtype,
+			Server:    s.address,
+			Transport: s.transport,
+			Attempt:   attempt,
+			Sent:      sent,
+			Latency:   time.Since(sent),
+			Rcode:     -1,
+			Outcome:   outcome,
+			EDE:       -1,
+		}
+		if r != nil {
+			a.Rcode = r.Rcode
+			if a.ExtendedErrors = extendedErrors(r); len(a.ExtendedErrors) > 0 {
+				a.EDE = int(a.ExtendedErrors[0].Code)
+			}
+		}
+		attempts = append(attempts, a)
+	}
+
+	for _, srv := range servers {
+		backoff := RETRY_BACKOFF
+		for attempt := 1; attempt <= RETRY_ATTEMPTS; attempt++ {
+			send(srv, attempt)
+			if outcome == storage.OutcomeTruncated && srv.transport == TRANSPORT_UDP {
+				// repeat over TCP at once
+				send(tcpServer(srv.address), attempt)
+			}
+			log.Debugf("%-30s: %s %s attempt %d (server %s)", query.Question[0].Name, dns.TypeToString[query.Question[0].Qtype], outcome, attempt, used)
+			if outcome.Answered() {
+				return r, used, outcome, attempts
+			}
+			if outcome != storage.OutcomeTimeout && outcome != storage.OutcomeNetwork {
+				break
+			}
+			if attempt < RETRY_ATTEMPTS {
+				time.Sleep(time.Duration(rand.Int63n(int64(backoff))))
+				if backoff *= 2; backoff > RETRY_BACKOFF_MAX {
+					backoff = RETRY_BACKOFF_MAX
+				}
+			}
+		}
+		log.Errorf("%-30s: %s %s (server %s)", query.Question[0].Name, dns.TypeToString[query.Question[0].Qtype], outcome, srv)
+	}
+	return r, used, outcome, attempts
+}
+
+// classify returns the outcome of one exchange.
+// A successful answer is OutcomeOK, saveAnswers decides if it is signed.
+func classify(r *dns.Msg, err error) storage.Outcome {
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return storage.OutcomeTimeout
+		}
+		return storage.OutcomeNetwork
+	}
+	if r == nil {
+		return storage.OutcomeNetwork
+	}
+	if r.Truncated {
+		return storage.OutcomeTruncated
+	}
+	switch r.Rcode {
+	case dns.RcodeSuccess:
+		return storage.OutcomeOK
+	case dns.RcodeNameError:
+		return storage.OutcomeNXDomain
+	case dns.RcodeServerFailure:
+		return storage.OutcomeServfail
+	case dns.RcodeRefused:
+		return storage.OutcomeRefused
+	}
+	return storage.OutcomeRcode
+}
+
+// failoverOrder returns all servers starting with servers[first]
+func failoverOrder(servers []server, first int) []server {
+	return append(append([]server{}, servers[first:]...), servers[:first]...)
+}
@@ -18,28 +18,38 @@ package cmd
 
 import (
 	"fmt"
-	"sort"
+	"strings"
 	"time"
 
-	"github.com/miekg/dns"
-
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"github.com/apex/log"
 
-	"database/sql"
-
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/ulrichwisser/dnssectiming/storage"
+	"github.com/ulrichwisser/dnssectiming/tldclass"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rfc6781Cmd = &cobra.Command{
-	Use:     "rfc6781",
+	Use:     "rfc6781 [--view daily|scorecard]",
 	Version: "0.0.1a",
 	Short:   "get DNSSEC timing data all TLD for RFC 6781 recommendations",
-	Long:   "get DNSSEC timing data all TLD for RFC 6781 recommendations",
+	Long: `get DNSSEC timing data all TLD for RFC 6781 recommendations
+
+The daily view (default) counts per day the ccTLD and gTLD whose SOA expire is
+below 3, between 3 and 4 or above 4 times the remaining signature lifetime.
+With --group-by TLD are counted per value of another attribute instead.
+
+Output columns: date [type] cc cc-short cc-ok cc-long g g-short g-ok g-long
+
+The scorecard view checks every TLD against RFC 6781 and RFC 7583: validity
+period and SOA expire, re-sign interval and validity period, backdating of the
+inception, TTL and validity period and the timing of key rollovers.
+Every check is pass, warn, fail or n/a with the RFC section it is based on.
+
+Output columns: tld check status citation detail`,
 	Run:     func(cmd *cobra.Command, args []string) { 
 		// debug command line arguments
 		log.Debug("Flags:")
@@ -55,116 +65,108 @@ var rfc6781Cmd = &cobra.Command{
 		log.Debugf("tld from viper: %s", viper.GetString(TLD))
 
 		// now run the command
-		rfc6781Run(args) 
+		rfc6781Run(args)
 	},
 }
 
 func init() {
 	// add the command to cobra
 	rootCmd.AddCommand(rfc6781Cmd)
+
+	// define command line arguments
+	rfc6781Cmd.Flags().String(VIEW, VIEW_DEFAULT, VIEW_DESCRIPTION)
+	addFailureModelFlags(rfc6781Cmd)
+	addRunFlags(rfc6781Cmd)
+	addSelectFlag(rfc6781Cmd)
+	addAllOwnersFlag(rfc6781Cmd)
+	addGroupFlags(rfc6781Cmd)
 }
 
 func rfc6781Run(args []string) {
 
-	// check RR command line arguments
-	var rrtype uint16 = 0
-	var rr_str = viper.GetString(RR)
-	if rr_str == "NS" {
-		rrtype = dns.TypeNS
-	}
-	if rr_str == "DNSKEY" {
-		rrtype = dns.TypeDNSKEY
-	}
-	if rrtype == 0 {
-		log.Fatal("No valid RR type was given. Must be one of NS or DNSKEY")
+	// check view command line argument
+	switch viper.GetString(VIEW) {
+	case VIEW_DAILY:
+	case VIEW_SCORECARD:
+		scorecardRun()
+		return
+	default:
+		log.Fatalf("No valid view was given. Must be one of %s or %s", VIEW_DAILY, VIEW_SCORECARD)
 	}
 
+	// check RR command line arguments
+	rrtypes := getRRTypes(true)
+
+	// check select command line argument
+	sel := getSelect()
+
+	// check failure model command line arguments
+	model := getFailureModel()
+
+	// check classification command line arguments, ccTLD and gTLD if not given
+	groups := getGroups(tldclass.AttrClass)
+
 	// open database
-	if viper.GetString(DBCREDENTIALS) == "" {
-		log.Fatal("No DB credentials given.")
-	}
-	db, err := sql.Open("mysql", viper.GetString(DBCREDENTIALS))
-	if err != nil {
-		log.Fatal(err.Error())
-	}
-	defer db.Close()
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Could not ping DB %s", err.Error())
-	}
-	log.Debug("DB OPEN")
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	runs := getRuns(store)
 
 	//
 	// Get SOA Expire
 	//
 	log.Debug("Start SQL Expire")
-	soaData, err := db.Query("SELECT RESOLVED,TLD,RRDATA FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE RRTYPE=? ORDER BY RESOLVED,TLD ", dns.TypeSOA)
+	soaData, err := store.SOAs(storage.Filter{Runs: runs})
 	if err != nil {
-		log.Fatalf("Could not query for SOA data %s", err)
+		log.Fatal(err.Error())
 	}
-	defer soaData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var soaByDateTLD map[time.Time]map[string]uint32 = make(map[time.Time]map[string]uint32, 0)
-	for soaData.Next() {
-		var resolved time.Time
-		var tld string
-		var rrdata string
-		err := soaData.Scan(&resolved, &tld, &rrdata)
-		if err != nil {
-			log.Fatalf("Error scanning SOA data %s", err)
-		}
-		rr, err := dns.NewRR(rrdata)
-		if err != nil {
-			log.Fatalf("Could not parse SOA record >%<\n%s", rrdata, err)
-		}
-
-		// prepare data structure
-		if _, ok := soaByDateTLD[resolved]; !ok {
-			soaByDateTLD[resolved] = make(map[string]uint32, 0)
-		}
 
-		// save data
-		soaByDateTLD[resolved][tld] = rr.(*dns.SOA).Expire
-		log.Debugf("%s %s Expire %d\n", resolved.Format(time.DateOnly), tld, soaByDateTLD[resolved][tld])
+	soaByProbe := newSOAIndex(soaData)
+	for _, soa := range soaData {
+		log.Debugf("%s %s Expire %d\n", soa.Resolved.Format(time.DateOnly), soa.TLD, soa.Record.Expire)
 	}
 
 	//
 	// Get lifetime
 	//
 	log.Debug("Start SQL")
-	rrData, err := db.Query("SELECT RESOLVED,TLD,EXPIRATION FROM RRSIG WHERE RRTYPE=? ORDER BY RESOLVED,TLD", rrtype)
+	rrData, err := store.Signatures(storage.Filter{RRTypes: rrtypes, Runs: runs, AllOwners: viper.GetBool(ALL_OWNERS)})
 	if err != nil {
-		log.Fatalf("Could not query for %s data %s", rr_str, err)
+		log.Fatal(err.Error())
 	}
-	defer rrData.Close() // Prepared statements take up server resources and should be closed after use.
-
-	var failedByDateTLD map[time.Time]map[string]int = make(map[time.Time]map[string]int, 0)
-	for rrData.Next() {
-		var resolved time.Time
-		var tld string
-		var expiration time.Time
-		err := rrData.Scan(&resolved, &tld, &expiration)
-		if err != nil {
-			log.Fatalf("Error scanning RR data. %s", err)
-		}
-		expire, ok := soaByDateTLD[resolved][tld]
+	rrData = selectSignatures(rrData, sel)
+
+	var failedByDateTLD map[time.Time]map[sampleKey]int = make(map[time.Time]map[sampleKey]int, 0)
+	var rulesByDateTLD map[time.Time]map[sampleKey][]string = make(map[time.Time]map[sampleKey][]string, 0)
+	var dropped int
+	for _, sig := range rrData {
+		resolved := normalizeDay(sig.Resolved.UTC())
+		tld := sig.TLD
+		soa, ok := soaByProbe.of(sig)
 		if !ok {
+			log.Debugf("%s %s no SOA in probe", sig.Resolved.Format(time.DateTime), tld)
+			dropped++
 			continue
 		}
-		lifetime := expiration.UTC().Unix() - resolved.UTC().Unix()
+		expire := soa.Expire
+		lifetime := sig.Lifetime()
+		sample := sampleKeyOf(sig, sel)
 
 		// prepare data structure
 		if _, ok := failedByDateTLD[resolved]; !ok {
-			failedByDateTLD[resolved] = make(map[string]int, 0)
+			failedByDateTLD[resolved] = make(map[sampleKey]int, 0)
+			rulesByDateTLD[resolved] = make(map[sampleKey][]string, 0)
 		}
 
 		// save data
+		rulesByDateTLD[resolved][sample] = model.failed(failureSample{Signature: sig, SOA: soa})
 		switch {
-        case int64(expire) <  3 * lifetime:	failedByDateTLD[resolved][tld] = -1 // too short
+        case int64(expire) <  3 * lifetime:	failedByDateTLD[resolved][sample] = -1 // too short
 		                                    log.Debugf("%s %s short", resolved.Format(time.DateOnly), tld, )
-        case int64(expire) <= 4 * lifetime: failedByDateTLD[resolved][tld] =  0 // correct
+        case int64(expire) <= 4 * lifetime: failedByDateTLD[resolved][sample] =  0 // correct
 		                                    log.Debugf("%s %s ok", resolved.Format(time.DateOnly), tld, )
-        case 4 * lifetime <  int64(expire):	failedByDateTLD[resolved][tld] =  1 // too long
+        case 4 * lifetime <  int64(expire):	failedByDateTLD[resolved][sample] =  1 // too long
 		                                    log.Debugf("%s %s long", resolved.Format(time.DateOnly), tld, )
 		default: log.Fatalf("%s %s  IS NOT CATEGORIZED!!! Lifetime %d  Expire %d", resolved.Format(time.DateOnly), tld, lifetime, expire)
 		}
@@ -173,54 +175,82 @@ func rfc6781Run(args []string) {
 	//
 	// compute daily summary
 	//
-	type dateStats struct {
-		cctld     int
-		ccShort   int
-		ccOK      int
-		ccLong    int
-		gtld      int
-		gtldShort int
-		gtldOK    int
-		gtldLong  int
+	type groupStats struct {
+		total int
+		short int
+		ok    int
+		long  int
 	}
-	var statsByDate map[time.Time]*dateStats = make(map[time.Time]*dateStats, 0)
+	var statsByDate map[dateKey]map[string]*groupStats = make(map[dateKey]map[string]*groupStats, 0)
+	var tlds map[string]bool = make(map[string]bool, 0)
 	for resolved := range failedByDateTLD {
-		for tld := range failedByDateTLD[resolved] {
+		for sample := range failedByDateTLD[resolved] {
+			tld := sample.tld
+			group := groups.of(tld)
+			tlds[tld] = true
 			// prepare data structure
-			if _, ok := statsByDate[resolved]; !ok {
-				statsByDate[resolved] = &dateStats{}
+			key := dateKeyOf(rrtypes, resolved, sample.rrtype)
+			if _, ok := statsByDate[key]; !ok {
+				statsByDate[key] = make(map[string]*groupStats, 0)
+			}
+			if _, ok := statsByDate[key][group]; !ok {
+				statsByDate[key][group] = &groupStats{}
 			}
 
-			if len(tld) == 3 {
-				statsByDate[resolved].cctld++
-				switch failedByDateTLD[resolved][tld] {
-				case -1: statsByDate[resolved].ccShort++
-				case  0: statsByDate[resolved].ccOK++
-				case  1: statsByDate[resolved].ccLong++
-				default: log.Fatalf("%s %s CCTLD no category %d", resolved.Format(time.DateOnly), tld, failedByDateTLD[resolved][tld])
-				}
-			} else {
-				statsByDate[resolved].gtld++
-				switch failedByDateTLD[resolved][tld] {
-				case -1: statsByDate[resolved].gtldShort++
-				case  0: statsByDate[resolved].gtldOK++
-				case  1: statsByDate[resolved].gtldLong++
-				default: log.Fatalf("%s %s GTLD no category %d", resolved.Format(time.DateOnly), tld, failedByDateTLD[resolved][tld])
-				}
+			statsByDate[key][group].total++
+			switch failedByDateTLD[resolved][sample] {
+			case -1: statsByDate[key][group].short++
+			case  0: statsByDate[key][group].ok++
+			case  1: statsByDate[key][group].long++
+			default: log.Fatalf("%s %s %s no category %d", resolved.Format(time.DateOnly), tld, group, failedByDateTLD[resolved][sample])
 			}
 		}
 	}
 
 	// get sorted lists of resolved
-	var resolvedList []time.Time
-	for resolved := range soaByDateTLD {
-		resolvedList = append(resolvedList, resolved)
+	var resolvedList []dateKey
+	for key := range statsByDate {
+		resolvedList = append(resolvedList, key)
+	}
+	sortDateKeys(resolvedList)
+
+	// four columns for every group
+	var tldList []string
+	for tld := range tlds {
+		tldList = append(tldList, tld)
+	}
+	values := groups.values(tldList)
+	var header []string
+	for _, value := range values {
+		header = append(header, value, value+"-short", value+"-ok", value+"-long")
 	}
-	sort.Slice(resolvedList, func(i, j int) bool { return resolvedList[i].Before(resolvedList[j]) })
 
 	// output final result
-	for _, resolved := range resolvedList {
-		fmt.Printf("%s %d %d %d %d %d %d %d %d\n", resolved.Format(time.DateOnly), statsByDate[resolved].cctld, statsByDate[resolved].ccShort, statsByDate[resolved].ccOK, statsByDate[resolved].ccLong, statsByDate[resolved].gtld, statsByDate[resolved].gtldShort, statsByDate[resolved].gtldOK, statsByDate[resolved].gtldLong)
+	fmt.Printf("# date%s %s\n", rrtypeHeader(rrtypes), strings.Join(header, " "))
+	for _, key := range resolvedList {
+		var counts []string
+		for _, value := range values {
+			s, ok := statsByDate[key][value]
+			if !ok {
+				s = &groupStats{}
+			}
+			counts = append(counts, fmt.Sprintf("%d %d %d %d", s.total, s.short, s.ok, s.long))
+		}
+		fmt.Printf("%s%s %s\n", key.date.Format(time.DateOnly), rrtypeColumn(rrtypes, key.rrtype), strings.Join(counts, " "))
+	}
+	fmt.Printf("# dropped %d samples without SOA\n", dropped)
+
+	// samples failing rules of the failure model
+	var failedByRule map[string]int = make(map[string]int, 0)
+	for resolved := range rulesByDateTLD {
+		for _, rules := range rulesByDateTLD[resolved] {
+			for _, rule := range rules {
+				failedByRule[rule]++
+			}
+		}
+	}
+	for _, rule := range model.names() {
+		fmt.Printf("# failed %s %d samples\n", rule, failedByRule[rule])
 	}
 
 }
@@ -0,0 +1,203 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+	"github.com/ulrichwisser/dnssectiming/tldclass"
+)
+
+// riskCmd evaluates the failure model for every TLD
+var riskCmd = &cobra.Command{
+	Use:     "risk [--tld <name>] [--rr <type>[,<type>...]] [--rules <rule>[,<rule>...]] [--max-ttl <duration>] [--group-by <attribute>]",
+	Version: "0.0.1a",
+	Short:   "evaluate the failure model for every TLD",
+	Long: `evaluate the failure model for every TLD
+
+Every signature is checked against the rules of the failure model, each rule
+gives the remaining lifetime a signature needs:
+
+soa-expire    SOA expire, secondary name servers serve the zone that long
+ttl           original TTL of the RR set, at most the resolver max TTL
+negative-ttl  lower of SOA minimum and SOA TTL for NSEC, NSEC3 and the SOA of denials, at most the resolver max TTL
+
+margin is the lowest remaining lifetime minus the lifetime needed in seconds,
+rule the rule needing the most lifetime for that signature and failed the
+number of signatures failing each rule. With --group-by the lines are made
+per value of a TLD attribute instead of per TLD.
+
+Output columns: tld [type] samples failed margin rule failed-rules`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		riskRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(riskCmd)
+
+	// define command line arguments
+	addFailureModelFlags(riskCmd)
+	addRunFlags(riskCmd)
+	addSelectFlag(riskCmd)
+	addAllOwnersFlag(riskCmd)
+	addGroupFlags(riskCmd)
+}
+
+// riskKey identifies one line of the risk report
+type riskKey struct {
+	tld    string
+	rrtype uint16
+}
+
+func riskRun(args []string) {
+
+	// check TLD command line argument, report all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, use all types if not given
+	rrtypes := getRRTypes(false)
+	filter.RRTypes = rrtypes
+
+	// check select command line argument
+	sel := getSelect()
+
+	// check failure model command line arguments
+	model := getFailureModel()
+
+	// check classification command line arguments, every TLD if not given
+	groups := getGroups(tldclass.AttrTLD)
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+	filter.AllOwners = viper.GetBool(ALL_OWNERS)
+
+	//
+	// Get SOA
+	//
+	soaData, err := store.SOAs(storage.Filter{TLD: filter.TLD, Runs: filter.Runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	soaByProbe := newSOAIndex(soaData)
+
+	//
+	// Evaluate signatures
+	//
+	rrData, err := store.Signatures(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	rrData = selectSignatures(rrData, sel)
+
+	type riskStats struct {
+		samples  int
+		failed   int
+		margin   int64
+		rule     string
+		failures map[string]int
+	}
+	var stats map[riskKey]*riskStats = make(map[riskKey]*riskStats, 0)
+	var dropped int
+	for _, sig := range rrData {
+		soa, ok := soaByProbe.of(sig)
+		if !ok {
+			log.Debugf("%s %s no SOA in probe", sig.Resolved.Format(time.DateTime), sig.TLD)
+			dropped++
+			continue
+		}
+		sample := failureSample{Signature: sig, SOA: soa}
+
+		key := riskKey{tld: groups.of(sig.TLD)}
+		if len(rrtypes) > 1 {
+			key.rrtype = sig.RRType
+		}
+		if _, ok := stats[key]; !ok {
+			stats[key] = &riskStats{failures: make(map[string]int, 0)}
+		}
+		s := stats[key]
+
+		s.samples++
+		failed := model.failed(sample)
+		if len(failed) > 0 {
+			s.failed++
+		}
+		for _, rule := range failed {
+			s.failures[rule]++
+		}
+		required, rule := model.required(sample)
+		if margin := sig.Lifetime() - required; s.samples == 1 || margin < s.margin {
+			s.margin, s.rule = margin, rule
+		}
+	}
+
+	var keys []riskKey
+	for key := range stats {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tld != keys[j].tld {
+			return keys[i].tld < keys[j].tld
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+
+	fmt.Printf("# %s%s samples failed margin rule failed-rules\n", groups.attribute, rrtypeHeader(rrtypes))
+	for _, key := range keys {
+		s := stats[key]
+		var failures []string
+		for _, rule := range model.names() {
+			if s.failures[rule] > 0 {
+				failures = append(failures, fmt.Sprintf("%s:%d", rule, s.failures[rule]))
+			}
+		}
+		if len(failures) == 0 {
+			failures = append(failures, "-")
+		}
+		rule := s.rule
+		if rule == "" {
+			rule = "-"
+		}
+		fmt.Printf("%s%s %d %d %d %s %s\n", key.tld, rrtypeColumn(rrtypes, key.rrtype), s.samples, s.failed, s.margin, rule, strings.Join(failures, ","))
+	}
+	fmt.Printf("# dropped %d samples without SOA\n", dropped)
+}
@@ -0,0 +1,800 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// rolloverCmd follows the chain of trust of every TLD
+var rolloverCmd = &cobra.Command{
+	Use:     "rollover [--tld <name>]",
+	Version: "0.0.1a",
+	Short:   "find key rollovers and check their timing",
+	Long: `find key rollovers and check their timing
+
+For every TLD and day the DNSKEY set, the DS set and the keys signing the
+DNSKEY set and the zone data are compared to the day before. Key tags are
+computed from the DNSKEY records, DS records are matched by their digest.
+Observations of all servers on one day are merged, times are those of the
+first observation of the day.
+
+Events are dnskey-added, dnskey-removed, ds-added, ds-removed, signing-started,
+signing-stopped (of the DNSKEY set with "dnskey", of zone data with "data"),
+algorithm-added and algorithm-removed. Every key introduced during the
+measurement is a rollover classified as pre-publish, double-signature,
+double-ds or algorithm. Timings breaking the safety intervals of RFC 7583
+and RFC 6781 are reported as violation.
+
+Output columns: date tld event keytag algorithm role detail`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		rolloverRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(rolloverCmd)
+
+	// define command line arguments
+	addRunFlags(rolloverCmd)
+}
+
+// events reported by rollover
+const (
+	ROLLOVER_DNSKEY_ADDED      = "dnskey-added"
+	ROLLOVER_DNSKEY_REMOVED    = "dnskey-removed"
+	ROLLOVER_DS_ADDED          = "ds-added"
+	ROLLOVER_DS_REMOVED        = "ds-removed"
+	ROLLOVER_SIGNING_STARTED   = "signing-started"
+	ROLLOVER_SIGNING_STOPPED   = "signing-stopped"
+	ROLLOVER_ALGORITHM_ADDED   = "algorithm-added"
+	ROLLOVER_ALGORITHM_REMOVED = "algorithm-removed"
+	ROLLOVER_ROLLOVER          = "rollover"
+	ROLLOVER_VIOLATION         = "violation"
+)
+
+// rollover methods
+const (
+	ROLLOVER_PREPUBLISH       = "pre-publish"
+	ROLLOVER_DOUBLE_SIGNATURE = "double-signature"
+	ROLLOVER_DOUBLE_DS        = "double-ds"
+	ROLLOVER_ALGORITHM        = "algorithm"
+)
+
+// key roles
+const (
+	ROLE_KSK = "ksk"
+	ROLE_ZSK = "zsk"
+	ROLE_CSK = "csk"
+)
+
+// keyID identifies a key the way DS and RRSIG records do
+type keyID struct {
+	tag uint16
+	alg uint8
+}
+
+// keySnapshot is the chain of trust of a TLD on one day
+type keySnapshot struct {
+	resolved  time.Time // first observation of the DNSKEY set
+	keys      map[keyID]*dns.DNSKEY
+	dsRecords []*dns.DS
+	ds        map[keyID]bool // true if the DS matches a published key
+	dsSeen    bool           // false if the DS set was not resolved, ds is copied from the day before
+	signed    bool           // signatures of the DNSKEY set with key tag were seen
+	signsKeys map[keyID]bool // keys signing the DNSKEY set
+	signsData map[keyID]bool // keys signing other RR sets
+	dataAlgs  map[uint8]bool // algorithms signing other RR sets
+}
+
+// keyHistory holds when a key changed its state, zero times are before
+// the first or after the last observation
+type keyHistory struct {
+	id         keyID
+	flags      uint16
+	known      bool // the key was seen in the DNSKEY set
+	signedData bool // the key signed zone data at least once
+	hadDS      bool
+
+	published, removed  time.Time
+	keysStart, keysStop time.Time
+	dataStart, dataStop time.Time
+	dsAdded, dsRemoved  time.Time
+
+	dataTTL uint32 // highest original TTL of zone data signed by the key
+}
+
+// role of the key, a key with SEP flag signing zone data is a combined signing key
+func (h *keyHistory) role() string {
+	if !h.known {
+		return "-"
+	}
+	if h.flags&dns.SEP == 0 {
+		return ROLE_ZSK
+	}
+	if h.signedData {
+		return ROLE_CSK
+	}
+	return ROLE_KSK
+}
+
+// rolloverEvent is one output line
+type rolloverEvent struct {
+	when   time.Time
+	tld    string
+	event  string
+	key    *keyHistory // nil for events of the TLD
+	alg    uint8       // algorithm of TLD events, 0 for none
+	detail string
+
+	// violations only
+	check    string // compliance check, see rfc6781 --view scorecard
+	citation string
+}
+
+func rolloverRun(args []string) {
+
+	// check TLD command line argument, follow all TLD if not given
+	var filter storage.Filter
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	events, _ := rolloverEvents(store, filter)
+
+	var count map[string]int = make(map[string]int, 0)
+	fmt.Println("# date tld event keytag algorithm role detail")
+	for _, e := range events {
+		keytag, alg, role := "-", "-", "-"
+		if e.key != nil {
+			keytag = fmt.Sprintf("%d", e.key.id.tag)
+			alg = fmt.Sprintf("%d", e.key.id.alg)
+			role = e.key.role()
+		} else if e.alg != 0 {
+			alg = fmt.Sprintf("%d", e.alg)
+		}
+		detail := e.detail
+		if e.citation != "" {
+			detail = e.citation + " " + detail
+		}
+		fmt.Printf("%s %s %s %s %s %s %s\n", e.when.Format(time.DateOnly), e.tld, e.event, keytag, alg, role, detail)
+		switch e.event {
+		case ROLLOVER_ROLLOVER:
+			count[strings.Fields(e.detail)[0]]++
+		case ROLLOVER_VIOLATION:
+			count[ROLLOVER_VIOLATION]++
+		}
+	}
+
+	// summary as gnuplot comment
+	for _, method := range []string{ROLLOVER_PREPUBLISH, ROLLOVER_DOUBLE_SIGNATURE, ROLLOVER_DOUBLE_DS, ROLLOVER_ALGORITHM} {
+		fmt.Printf("# %s %d rollovers\n", method, count[method])
+	}
+	fmt.Printf("# %d violations\n", count[ROLLOVER_VIOLATION])
+}
+
+// rolloverEvents returns the timeline, rollovers and violations of all TLD ordered by day and TLD
+// and the TLD the chain of trust could be checked for on at least one day
+func rolloverEvents(store storage.Store, filter storage.Filter) ([]rolloverEvent, map[string]bool) {
+	// tld -> day -> snapshot
+	var snapshots map[string]map[time.Time]*keySnapshot = make(map[string]map[time.Time]*keySnapshot, 0)
+	snapshotOf := func(tld string, resolved time.Time) *keySnapshot {
+		day := normalizeDay(resolved.UTC())
+		if _, ok := snapshots[tld]; !ok {
+			snapshots[tld] = make(map[time.Time]*keySnapshot, 0)
+		}
+		if _, ok := snapshots[tld][day]; !ok {
+			snapshots[tld][day] = &keySnapshot{
+				keys:      make(map[keyID]*dns.DNSKEY, 0),
+				ds:        make(map[keyID]bool, 0),
+				signsKeys: make(map[keyID]bool, 0),
+				signsData: make(map[keyID]bool, 0),
+				dataAlgs:  make(map[uint8]bool, 0),
+			}
+		}
+		return snapshots[tld][day]
+	}
+	var dnskeyTTL map[string]uint32 = make(map[string]uint32, 0)
+	var dsTTL map[string]uint32 = make(map[string]uint32, 0)
+
+	//
+	// DNSKEY and DS sets
+	//
+	for _, rrtype := range []uint16{dns.TypeDNSKEY, dns.TypeDS} {
+		rrData, err := store.RRSets(storage.Filter{TLD: filter.TLD, RRType: rrtype, Runs: filter.Runs})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		for _, rrset := range rrData {
+			if rrset.Owner != "" {
+				continue
+			}
+			rrs, err := rrset.RRs()
+			if err != nil {
+				log.Fatalf("%s %s %s %s", rrset.Resolved.Format(time.DateOnly), rrset.TLD, dns.TypeToString[rrtype], err)
+			}
+			snap := snapshotOf(rrset.TLD, rrset.Resolved)
+			for _, rr := range rrs {
+				switch rr := rr.(type) {
+				case *dns.DNSKEY:
+					snap.keys[keyID{tag: rr.KeyTag(), alg: rr.Algorithm}] = rr
+					if rr.Hdr.Ttl > dnskeyTTL[rrset.TLD] {
+						dnskeyTTL[rrset.TLD] = rr.Hdr.Ttl
+					}
+				case *dns.DS:
+					snap.dsRecords = append(snap.dsRecords, rr)
+					if rr.Hdr.Ttl > dsTTL[rrset.TLD] {
+						dsTTL[rrset.TLD] = rr.Hdr.Ttl
+					}
+				}
+			}
+			if rrtype == dns.TypeDS {
+				snap.dsSeen = true
+			} else if snap.resolved.IsZero() || rrset.Resolved.Before(snap.resolved) {
+				snap.resolved = rrset.Resolved.UTC()
+			}
+		}
+	}
+
+	//
+	// keys used for signing
+	//
+	sigData, err := store.Signatures(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	var dataTTL map[string]map[keyID]uint32 = make(map[string]map[keyID]uint32, 0)
+	for _, sig := range sigData {
+		// signatures stored before schema version 2 have no key tag
+		if sig.KeyTag == 0 || sig.RRType == dns.TypeDS || !strings.EqualFold(sig.SignerName, sig.TLD) {
+			continue
+		}
+		snap := snapshotOf(sig.TLD, sig.Resolved)
+		id := keyID{tag: sig.KeyTag, alg: sig.Algorithm}
+		if sig.RRType == dns.TypeDNSKEY && sig.Owner == "" {
+			snap.signed = true
+			snap.signsKeys[id] = true
+			continue
+		}
+		snap.signsData[id] = true
+		snap.dataAlgs[sig.Algorithm] = true
+		if _, ok := dataTTL[sig.TLD]; !ok {
+			dataTTL[sig.TLD] = make(map[keyID]uint32, 0)
+		}
+		if sig.OrigTTL > dataTTL[sig.TLD][id] {
+			dataTTL[sig.TLD][id] = sig.OrigTTL
+		}
+	}
+
+	var tlds []string
+	for tld := range snapshots {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+
+	var events []rolloverEvent
+	var chained map[string]bool = make(map[string]bool, 0)
+	for _, tld := range tlds {
+		// days without DNSKEY set can not be compared
+		var days []*keySnapshot
+		for _, snap := range snapshots[tld] {
+			if len(snap.keys) == 0 {
+				continue
+			}
+			matchDS(snap)
+			days = append(days, snap)
+			if checked, _ := chainOfTrust(snap); checked {
+				chained[tld] = true
+			}
+		}
+		sort.Slice(days, func(i, j int) bool { return days[i].resolved.Before(days[j].resolved) })
+		if len(days) == 0 {
+			continue
+		}
+		events = append(events, rolloverTimeline(tld, days, dnskeyTTL[tld], dsTTL[tld], dataTTL[tld])...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		di, dj := normalizeDay(events[i].when), normalizeDay(events[j].when)
+		if !di.Equal(dj) {
+			return di.Before(dj)
+		}
+		return events[i].tld < events[j].tld
+	})
+
+	return events, chained
+}
+
+// chainOfTrust reports if the chain of trust can be checked on a day, DS and signed DNSKEY set were seen,
+// and if it is valid, a DS matches a key signing the DNSKEY set
+func chainOfTrust(snap *keySnapshot) (bool, bool) {
+	if !snap.dsSeen || !snap.signed || len(snap.ds) == 0 {
+		return false, false
+	}
+	var valid bool
+	for id, matched := range snap.ds {
+		valid = valid || (matched && snap.signsKeys[id])
+	}
+	return true, valid
+}
+
+// matchDS computes which DS records match a published key
+func matchDS(snap *keySnapshot) {
+	for _, ds := range snap.dsRecords {
+		id := keyID{tag: ds.KeyTag, alg: ds.Algorithm}
+		key, ok := snap.keys[id]
+		if !ok {
+			if _, seen := snap.ds[id]; !seen {
+				snap.ds[id] = false
+			}
+			continue
+		}
+		digest := key.ToDS(ds.DigestType)
+		snap.ds[id] = snap.ds[id] || (digest != nil && strings.EqualFold(digest.Digest, ds.Digest))
+	}
+}
+
+// rolloverTimeline compares the days of one TLD and returns events, rollovers and violations
+func rolloverTimeline(tld string, days []*keySnapshot, dnskeyTTL uint32, dsTTL uint32, dataTTL map[keyID]uint32) []rolloverEvent {
+	var events []rolloverEvent
+	var histories map[keyID]*keyHistory = make(map[keyID]*keyHistory, 0)
+	historyOf := func(id keyID) *keyHistory {
+		if _, ok := histories[id]; !ok {
+			histories[id] = &keyHistory{id: id, dataTTL: dataTTL[id]}
+		}
+		return histories[id]
+	}
+	event := func(when time.Time, name string, key *keyHistory, detail string) {
+		events = append(events, rolloverEvent{when: when, tld: tld, event: name, key: key, detail: detail})
+	}
+	violation := func(when time.Time, key *keyHistory, check string, citation string, detail string) {
+		events = append(events, rolloverEvent{when: when, tld: tld, event: ROLLOVER_VIOLATION, key: key, detail: detail, check: check, citation: citation})
+	}
+	algorithms := func(snap *keySnapshot) map[uint8]bool {
+		var algs map[uint8]bool = make(map[uint8]bool, 0)
+		for id := range snap.keys {
+			algs[id.alg] = true
+		}
+		return algs
+	}
+
+	// state of the first day
+	for id, key := range days[0].keys {
+		h := historyOf(id)
+		h.flags = key.Flags
+		h.known = true
+	}
+	for id, matched := range days[0].ds {
+		historyOf(id).hadDS = historyOf(id).hadDS || matched
+	}
+	for id := range days[0].signsData {
+		historyOf(id).signedData = true
+	}
+	if checked, valid := chainOfTrust(days[0]); checked && !valid {
+		violation(days[0].resolved, nil, CHECK_CHAIN_OF_TRUST, CITE_CHAIN_OF_TRUST, "no DS matches a key signing the DNSKEY set")
+	}
+
+	// changes from day to day
+	for i := 1; i < len(days); i++ {
+		prev, cur := days[i-1], days[i]
+		when := cur.resolved
+		if !cur.dsSeen {
+			cur.ds = prev.ds
+		}
+
+		for id, key := range cur.keys {
+			h := historyOf(id)
+			h.flags = key.Flags
+			h.known = true
+			if _, ok := prev.keys[id]; !ok && h.published.IsZero() {
+				h.published = when
+				event(when, ROLLOVER_DNSKEY_ADDED, h, fmt.Sprintf("flags=%d", key.Flags))
+			}
+		}
+		for id := range prev.keys {
+			if _, ok := cur.keys[id]; !ok {
+				h := historyOf(id)
+				if h.removed.IsZero() {
+					h.removed = when
+				}
+				event(when, ROLLOVER_DNSKEY_REMOVED, h, "")
+			}
+		}
+
+		for id, matched := range cur.ds {
+			h := historyOf(id)
+			h.hadDS = h.hadDS || matched
+			if _, ok := prev.ds[id]; !ok {
+				if h.dsAdded.IsZero() {
+					h.dsAdded = when
+				}
+				detail := "matched"
+				if !matched {
+					detail = "unmatched"
+				}
+				event(when, ROLLOVER_DS_ADDED, h, detail)
+			}
+		}
+		for id := range prev.ds {
+			if _, ok := cur.ds[id]; !ok {
+				h := historyOf(id)
+				if h.dsRemoved.IsZero() {
+					h.dsRemoved = when
+				}
+				event(when, ROLLOVER_DS_REMOVED, h, "")
+			}
+		}
+
+		// only compare signing keys if signatures were seen on both days
+		if prev.signed && cur.signed {
+			for id := range cur.signsKeys {
+				if !prev.signsKeys[id] {
+					h := historyOf(id)
+					if h.keysStart.IsZero() {
+						h.keysStart = when
+					}
+					event(when, ROLLOVER_SIGNING_STARTED, h, "dnskey")
+				}
+			}
+			for id := range prev.signsKeys {
+				if !cur.signsKeys[id] {
+					h := historyOf(id)
+					if h.keysStop.IsZero() {
+						h.keysStop = when
+					}
+					event(when, ROLLOVER_SIGNING_STOPPED, h, "dnskey")
+				}
+			}
+		}
+		if len(prev.signsData) > 0 && len(cur.signsData) > 0 {
+			for id := range cur.signsData {
+				h := historyOf(id)
+				h.signedData = true
+				if !prev.signsData[id] {
+					if h.dataStart.IsZero() {
+						h.dataStart = when
+					}
+					event(when, ROLLOVER_SIGNING_STARTED, h, "data")
+				}
+			}
+			for id := range prev.signsData {
+				if !cur.signsData[id] {
+					h := historyOf(id)
+					if h.dataStop.IsZero() {
+						h.dataStop = when
+					}
+					event(when, ROLLOVER_SIGNING_STOPPED, h, "data")
+				}
+			}
+		}
+
+		prevAlgs, curAlgs := algorithms(prev), algorithms(cur)
+		for alg := range curAlgs {
+			if !prevAlgs[alg] {
+				events = append(events, rolloverEvent{when: when, tld: tld, event: ROLLOVER_ALGORITHM_ADDED, alg: alg})
+				events = append(events, algorithmAdded(tld, days, i, alg, dataTTL)...)
+			}
+		}
+		for alg := range prevAlgs {
+			if !curAlgs[alg] {
+				events = append(events, rolloverEvent{when: when, tld: tld, event: ROLLOVER_ALGORITHM_REMOVED, alg: alg})
+				events = append(events, algorithmRemoved(tld, days, i, alg, dnskeyTTL)...)
+			}
+		}
+
+		if checked, valid := chainOfTrust(cur); checked && !valid {
+			violation(when, nil, CHECK_CHAIN_OF_TRUST, CITE_CHAIN_OF_TRUST, "no DS matches a key signing the DNSKEY set")
+		}
+	}
+
+	var ids []keyID
+	for id := range histories {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].tag != ids[j].tag {
+			return ids[i].tag < ids[j].tag
+		}
+		return ids[i].alg < ids[j].alg
+	})
+
+	// the day a key was published on, the day before and the day a state started
+	dayOf := func(when time.Time) int {
+		for i, snap := range days {
+			if snap.resolved.Equal(when) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	for _, id := range ids {
+		h := histories[id]
+		if !h.known {
+			// DS or signatures without key
+			continue
+		}
+
+		// rollovers of keys introduced during the measurement
+		if !h.published.IsZero() {
+			events = append(events, classifyRollover(tld, days, dayOf(h.published), h, histories))
+			events = append(events, checkIntroduction(tld, days, dayOf, h, histories, dnskeyTTL, dsTTL)...)
+		}
+
+		// retirement of keys
+		if h.removed.IsZero() {
+			continue
+		}
+		role := h.role()
+		// cached zone data must all be signed by a key still published
+		if role != ROLE_KSK && h.signedData {
+			if day := dayOf(h.removed); day >= 0 {
+				if interval, ok := successorSigning(days[day], h, histories, time.Duration(h.dataTTL)*time.Second); !ok {
+					violation(h.removed, h, CHECK_ZSK_ROLLOVER, CITE_ZSK_ROLLOVER, fmt.Sprintf("key removed %s after another key started signing, TTL %s", dur2str(interval), dur2str(time.Duration(h.dataTTL)*time.Second)))
+				}
+			}
+		}
+		// cached DS sets must all hold the DS of a key still signing the DNSKEY set
+		if role != ROLE_ZSK && h.hadDS {
+			if day := dayOf(h.removed); day >= 0 && !successorDS(days[day], h, histories, dsTTL) {
+				violation(h.removed, h, CHECK_KSK_ROLLOVER, CITE_DOUBLE_KSK, fmt.Sprintf("key removed before the DS of another signing key was published for DS TTL %s", dur2str(time.Duration(dsTTL)*time.Second)))
+			}
+		}
+	}
+
+	// removing the DS of a key needs another key published long enough
+	for _, id := range ids {
+		old := histories[id]
+		if old.dsRemoved.IsZero() || old.role() == ROLE_ZSK {
+			continue
+		}
+		day := dayOf(old.dsRemoved)
+		if day < 0 {
+			continue
+		}
+		for other, matched := range days[day].ds {
+			h, ok := histories[other]
+			if !ok || !matched || other == id || h.published.IsZero() || h.published.After(old.dsRemoved) {
+				continue
+			}
+			if interval := old.dsRemoved.Sub(h.published); interval < time.Duration(dnskeyTTL)*time.Second {
+				violation(old.dsRemoved, h, CHECK_KSK_ROLLOVER, CITE_DOUBLE_KSK, fmt.Sprintf("DS of %d removed %s after publication of new key, DNSKEY TTL %s", old.id.tag, dur2str(interval), dur2str(time.Duration(dnskeyTTL)*time.Second)))
+			}
+		}
+	}
+
+	return events
+}
+
+// classifyRollover finds the method used to introduce a key
+func classifyRollover(tld string, days []*keySnapshot, day int, h *keyHistory, histories map[keyID]*keyHistory) rolloverEvent {
+	role := h.role()
+	prev, cur := days[day-1], days[day]
+
+	// keys of the same role that are retired later
+	var replaced []string
+	for id := range prev.keys {
+		old := histories[id]
+		if old != nil && old.role() == role && !old.removed.IsZero() && old.removed.After(h.published) {
+			replaced = append(replaced, fmt.Sprintf("%d", id.tag))
+		}
+	}
+	sort.Strings(replaced)
+
+	var prevAlgs map[uint8]bool = make(map[uint8]bool, 0)
+	for id := range prev.keys {
+		prevAlgs[id.alg] = true
+	}
+
+	// a new key signing on its first day is a double signature rollover if
+	// another key of the same role still signs
+	othersSign := func(signs map[keyID]bool) bool {
+		for id := range signs {
+			if other, ok := histories[id]; ok && id != h.id && other.role() == role {
+				return true
+			}
+		}
+		return false
+	}
+
+	var method string
+	switch {
+	case !prevAlgs[h.id.alg]:
+		method = ROLLOVER_ALGORITHM
+	case role == ROLE_ZSK:
+		method = ROLLOVER_PREPUBLISH
+		if cur.signsData[h.id] && othersSign(cur.signsData) {
+			method = ROLLOVER_DOUBLE_SIGNATURE
+		}
+	case !h.dsAdded.IsZero() && h.dsAdded.Before(h.published):
+		method = ROLLOVER_DOUBLE_DS
+	default:
+		method = ROLLOVER_PREPUBLISH
+		if cur.signsKeys[h.id] && othersSign(cur.signsKeys) {
+			method = ROLLOVER_DOUBLE_SIGNATURE
+		}
+	}
+	detail := method
+	if len(replaced) > 0 {
+		detail += " replaces " + strings.Join(replaced, ",")
+	}
+	return rolloverEvent{when: h.published, tld: tld, event: ROLLOVER_ROLLOVER, key: h, detail: detail}
+}
+
+// checkIntroduction checks the publication interval of a new key
+func checkIntroduction(tld string, days []*keySnapshot, dayOf func(time.Time) int, h *keyHistory, histories map[keyID]*keyHistory, dnskeyTTL uint32, dsTTL uint32) []rolloverEvent {
+	var events []rolloverEvent
+	violation := func(when time.Time, check string, citation string, detail string) {
+		events = append(events, rolloverEvent{when: when, tld: tld, event: ROLLOVER_VIOLATION, key: h, detail: detail, check: check, citation: citation})
+	}
+
+	// a new zone signing key must be in caches before it is the only one signing
+	if h.signedData {
+		// keys of a new algorithm sign before they are published
+		start := h.dataStart
+		if start.IsZero() {
+			start = h.published
+		}
+		if day := dayOf(start); day >= 0 && !start.Before(h.published) && !othersSignData(days[day], h) {
+			if interval := start.Sub(h.published); interval < time.Duration(dnskeyTTL)*time.Second {
+				violation(start, CHECK_ZSK_ROLLOVER, CITE_ZSK_ROLLOVER, fmt.Sprintf("key signs alone %s after publication, DNSKEY TTL %s", dur2str(interval), dur2str(time.Duration(dnskeyTTL)*time.Second)))
+			}
+		}
+	}
+
+	// a new key signing key must have its DS in caches before it is the only one signing the DNSKEY set
+	if h.role() != ROLE_ZSK && !h.keysStart.IsZero() && !h.dsAdded.IsZero() && h.dsAdded.Before(h.published) {
+		if day := dayOf(h.keysStart); day >= 0 && !othersSignKeys(days[day], h) {
+			if interval := h.keysStart.Sub(h.dsAdded); interval < time.Duration(dsTTL)*time.Second {
+				violation(h.keysStart, CHECK_KSK_ROLLOVER, CITE_DOUBLE_DS, fmt.Sprintf("key signs DNSKEY alone %s after its DS, DS TTL %s", dur2str(interval), dur2str(time.Duration(dsTTL)*time.Second)))
+			}
+		}
+	}
+	return events
+}
+
+// othersSignData reports if another key with the same algorithm signs zone data
+func othersSignData(snap *keySnapshot, h *keyHistory) bool {
+	for id := range snap.signsData {
+		if id != h.id && id.alg == h.id.alg {
+			return true
+		}
+	}
+	return false
+}
+
+// successorSigning reports if another key signing zone data when h is removed started signing
+// at least ttl before, the interval is the longest time another key was signing
+func successorSigning(snap *keySnapshot, h *keyHistory, histories map[keyID]*keyHistory, ttl time.Duration) (time.Duration, bool) {
+	var longest time.Duration
+	for id := range snap.signsData {
+		other, ok := histories[id]
+		if !ok || id == h.id {
+			continue
+		}
+		if other.dataStart.IsZero() {
+			// signing since the first observation
+			return 0, true
+		}
+		if interval := h.removed.Sub(other.dataStart); interval > longest {
+			longest = interval
+		}
+	}
+	return longest, longest >= ttl
+}
+
+// successorDS reports if another key signing the DNSKEY set has a DS published at least DS TTL before h is removed
+func successorDS(snap *keySnapshot, h *keyHistory, histories map[keyID]*keyHistory, dsTTL uint32) bool {
+	for id := range snap.signsKeys {
+		other, ok := histories[id]
+		if !ok || id == h.id || !snap.ds[id] {
+			continue
+		}
+		if other.dsAdded.IsZero() || h.removed.Sub(other.dsAdded) >= time.Duration(dsTTL)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+// othersSignKeys reports if another key with matching DS signs the DNSKEY set
+func othersSignKeys(snap *keySnapshot, h *keyHistory) bool {
+	for id := range snap.signsKeys {
+		if id != h.id && snap.ds[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// algorithmAdded checks that zone data was signed with a new algorithm before its keys were published.
+// Keys published on the day signing starts are not flagged, the order within one day is not known.
+func algorithmAdded(tld string, days []*keySnapshot, day int, alg uint8, dataTTL map[keyID]uint32) []rolloverEvent {
+	var ttl uint32
+	for id, t := range dataTTL {
+		if id.alg == alg && t > ttl {
+			ttl = t
+		}
+	}
+	published := days[day].resolved
+	first := -1
+	for i, snap := range days {
+		if snap.dataAlgs[alg] {
+			first = i
+			break
+		}
+	}
+	switch {
+	case first < 0 || first == day:
+		return nil
+	case first > day:
+		return []rolloverEvent{{when: published, tld: tld, event: ROLLOVER_VIOLATION, alg: alg, check: CHECK_ALGORITHM_ROLLOVER, citation: CITE_ALGORITHM_ROLLOVER, detail: fmt.Sprintf("DNSKEY published %s before zone data is signed with the algorithm", dur2str(days[first].resolved.Sub(published)))}}
+	}
+	if interval := published.Sub(days[first].resolved); interval < time.Duration(ttl)*time.Second {
+		return []rolloverEvent{{when: published, tld: tld, event: ROLLOVER_VIOLATION, alg: alg, check: CHECK_ALGORITHM_ROLLOVER, citation: CITE_ALGORITHM_ROLLOVER, detail: fmt.Sprintf("DNSKEY published %s after signatures, TTL %s", dur2str(interval), dur2str(time.Duration(ttl)*time.Second))}}
+	}
+	return nil
+}
+
+// algorithmRemoved checks that signatures of an algorithm stay until its keys expired from caches
+func algorithmRemoved(tld string, days []*keySnapshot, day int, alg uint8, dnskeyTTL uint32) []rolloverEvent {
+	removed := days[day].resolved
+	for _, snap := range days[day:] {
+		if snap.dataAlgs[alg] {
+			continue
+		}
+		if interval := snap.resolved.Sub(removed); interval < time.Duration(dnskeyTTL)*time.Second {
+			return []rolloverEvent{{when: snap.resolved, tld: tld, event: ROLLOVER_VIOLATION, alg: alg, check: CHECK_ALGORITHM_ROLLOVER, citation: CITE_ALGORITHM_ROLLOVER, detail: fmt.Sprintf("signatures removed %s after DNSKEY, DNSKEY TTL %s", dur2str(interval), dur2str(time.Duration(dnskeyTTL)*time.Second))}}
+		}
+		break
+	}
+	return nil
+}
+
+// dur2str formats an interval in the way of sec2str, zero is 0s
+func dur2str(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+	return sec2str(int64(d / time.Second))
+}
@@ -26,8 +26,6 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/apex/log"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -36,6 +34,11 @@ var rootCmd = &cobra.Command{
 	Version: "0.0.1a",
 	Short:   "get dnssec timing information",
 	Long:    `get dnssec timing information`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// several commands define the same flags, only those of the
+		// command that is run are used for viper values
+		viper.BindPFlags(cmd.Flags())
+	},
 }
 
 func init() {
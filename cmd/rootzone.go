@@ -0,0 +1,79 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"net"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// readRootZone reads a copy of the root zone (e.g. https://www.internic.net/domain/root.zone)
+// and returns the addresses of all name servers of every TLD.
+// Name server addresses are taken from the glue records, IPv4 and IPv6.
+// Name servers without glue in the root zone are returned by name.
+func readRootZone(filename string) (map[string][]string, map[string][]string, error) {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fh.Close()
+
+	var nsByTLD map[string][]string = make(map[string][]string, 0)
+	var glue map[string][]string = make(map[string][]string, 0)
+
+	zp := dns.NewZoneParser(fh, ".", filename)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		owner := strings.ToLower(rr.Header().Name)
+		switch rr := rr.(type) {
+		case *dns.NS:
+			// only delegations of TLD are of interest
+			if dns.CountLabel(owner) != 1 {
+				continue
+			}
+			nsByTLD[owner] = append(nsByTLD[owner], strings.ToLower(rr.Ns))
+		case *dns.A:
+			glue[owner] = append(glue[owner], serverAddress(rr.A))
+		case *dns.AAAA:
+			glue[owner] = append(glue[owner], serverAddress(rr.AAAA))
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var servers map[string][]string = make(map[string][]string, 0)
+	var glueless map[string][]string = make(map[string][]string, 0)
+	for tld, nsList := range nsByTLD {
+		servers[tld] = []string{}
+		for _, ns := range nsList {
+			if len(glue[ns]) == 0 {
+				glueless[tld] = append(glueless[tld], ns)
+				continue
+			}
+			servers[tld] = append(servers[tld], glue[ns]...)
+		}
+	}
+	return servers, glueless, nil
+}
+
+// serverAddress returns ip:53, IPv6 addresses in brackets
+func serverAddress(ip net.IP) string {
+	return net.JoinHostPort(ip.String(), "53")
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// runsCmd lists all runs of measure
+var runsCmd = &cobra.Command{
+	Use:     "runs [--run <id>] [--from <date>] [--to <date>]",
+	Version: "0.0.1a",
+	Short:   "list all runs of measure",
+	Long: `list all runs of measure
+
+For every run the start and end time, the resolvers, the SHA256 of the
+domain list and the number of saved and failed queries per RR type are shown.
+Runs that did not finish are marked as partial.`,
+	Run:  func(cmd *cobra.Command, args []string) { runsRun(args) },
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(runsCmd)
+
+	// define command line arguments, all runs are listed, partial or not
+	runsCmd.Flags().IntSlice(RUN, []int{}, RUN_DESCRIPTION)
+	runsCmd.Flags().String(FROM, "", FROM_DESCRIPTION)
+	runsCmd.Flags().String(TO, "", TO_DESCRIPTION)
+}
+
+func runsRun(args []string) {
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	runs, err := store.Runs()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	for _, run := range filterRuns(runs) {
+		finished := "partial"
+		if !run.Partial() {
+			finished = run.Finished.UTC().Format(time.DateTime)
+		}
+
+		var rrtypes []int
+		for rrtype := range run.Counts {
+			rrtypes = append(rrtypes, int(rrtype))
+		}
+		sort.Ints(rrtypes)
+		var counts []string
+		for _, rrtype := range rrtypes {
+			count := run.Counts[uint16(rrtype)]
+			counts = append(counts, fmt.Sprintf("%s %d/%d", dns.TypeToString[uint16(rrtype)], count.Success, count.Failure))
+		}
+
+		fmt.Printf("%d %s %s %s %s %s\n", run.ID, run.Started.UTC().Format(time.DateTime), finished, strings.Join(run.Resolvers, ","), run.InputHash, strings.Join(counts, " "))
+	}
+}
+
+// addRunFlags adds the command line arguments selecting runs to an analysis command
+func addRunFlags(cmd *cobra.Command) {
+	cmd.Flags().IntSlice(RUN, []int{}, RUN_DESCRIPTION)
+	cmd.Flags().String(FROM, "", FROM_DESCRIPTION)
+	cmd.Flags().String(TO, "", TO_DESCRIPTION)
+	cmd.Flags().Bool(PARTIAL, false, PARTIAL_DESCRIPTION)
+}
+
+// getRuns selects the runs given by --run, --from and --to.
+// Without these arguments nil is returned, all observations are used then,
+// also those saved before runs were recorded.
+// Partial runs are left out with a warning unless --partial is given,
+// a partial run asked for by --run is refused.
+func getRuns(store storage.Store) []int64 {
+	runs, err := store.Runs()
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	selected := filterRuns(runs)
+	explicit := len(viper.GetIntSlice(RUN)) > 0
+	all := !explicit && viper.GetString(FROM) == "" && viper.GetString(TO) == ""
+
+	var ids []int64
+	var partial []string
+	for _, run := range selected {
+		if run.Partial() && !viper.GetBool(PARTIAL) {
+			partial = append(partial, fmt.Sprintf("%d", run.ID))
+			continue
+		}
+		ids = append(ids, run.ID)
+	}
+	if len(partial) > 0 {
+		if explicit {
+			log.Fatalf("Run %s did not finish. Use --partial to analyse it anyway.", strings.Join(partial, ","))
+		}
+		log.Warnf("Run %s did not finish and is left out. Use --partial to analyse it anyway.", strings.Join(partial, ","))
+	}
+
+	if all {
+		if len(partial) == 0 {
+			return nil
+		}
+		// observations saved before runs were recorded are still used
+		return append(ids, storage.NoRun)
+	}
+	if len(ids) == 0 {
+		log.Fatal("No runs selected.")
+	}
+	return ids
+}
+
+// filterRuns returns the runs matching --run, --from and --to
+func filterRuns(runs []storage.Run) []storage.Run {
+	var from, to time.Time
+	var err error
+	if s := viper.GetString(FROM); s != "" {
+		if from, err = time.Parse(time.DateOnly, s); err != nil {
+			log.Fatalf("Could not parse date %s", s)
+		}
+	}
+	if s := viper.GetString(TO); s != "" {
+		if to, err = time.Parse(time.DateOnly, s); err != nil {
+			log.Fatalf("Could not parse date %s", s)
+		}
+	}
+
+	var wanted map[int64]bool = make(map[int64]bool, 0)
+	for _, id := range viper.GetIntSlice(RUN) {
+		wanted[int64(id)] = true
+	}
+
+	var found map[int64]bool = make(map[int64]bool, 0)
+	var selected []storage.Run
+	for _, run := range runs {
+		day := normalizeDay(run.Started.UTC())
+		if len(wanted) > 0 && !wanted[run.ID] {
+			continue
+		}
+		found[run.ID] = true
+		if !from.IsZero() && day.Before(from) {
+			continue
+		}
+		if !to.IsZero() && day.After(to) {
+			continue
+		}
+		selected = append(selected, run)
+	}
+	for id := range wanted {
+		if !found[id] {
+			log.Fatalf("Run %d does not exist.", id)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,233 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// owner name of the samples of denial proofs
+const SAMPLE_PROOF = "<proof>"
+
+// sampleKey identifies one sample of an analysis.
+// KeyTag is only set if signatures are selected per key tag,
+// server only for name servers, every name server of a TLD is a sample of its own.
+type sampleKey struct {
+	tld    string
+	owner  string
+	rrtype uint16
+	keytag uint16
+	server string
+}
+
+// dateKey identifies one output line of a daily summary.
+// RRType is only set if more than one type was asked for.
+type dateKey struct {
+	date   time.Time
+	rrtype uint16
+}
+
+// sortDateKeys sorts by date and RR type
+func sortDateKeys(keys []dateKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].date.Equal(keys[j].date) {
+			return keys[i].date.Before(keys[j].date)
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+}
+
+// getRRTypes checks the RR command line argument, a comma separated list of RR types.
+// If no type is given all types are used, unless a type is required.
+func getRRTypes(required bool) []uint16 {
+	var rrtypes []uint16
+	var seen map[uint16]bool = make(map[uint16]bool, 0)
+	for _, rr_str := range strings.Split(viper.GetString(RR), ",") {
+		rr_str = strings.ToUpper(strings.TrimSpace(rr_str))
+		if rr_str == "" {
+			continue
+		}
+		rrtype, ok := dns.StringToType[rr_str]
+		if !ok {
+			log.Fatalf("Unknown RR type %s", rr_str)
+		}
+		if !seen[rrtype] {
+			seen[rrtype] = true
+			rrtypes = append(rrtypes, rrtype)
+		}
+	}
+	if required && len(rrtypes) == 0 {
+		log.Fatal("No RR type was given")
+	}
+	log.Debugf("RRTYPE %v", rrtypes)
+	return rrtypes
+}
+
+// rrtypeColumn returns the RR type output column, it is only printed if more than one type was asked for
+func rrtypeColumn(rrtypes []uint16, rrtype uint16) string {
+	if len(rrtypes) < 2 {
+		return ""
+	}
+	return " " + dns.TypeToString[rrtype]
+}
+
+// rrtypeHeader returns the header of the RR type column if more than one type was asked for
+func rrtypeHeader(rrtypes []uint16) string {
+	if len(rrtypes) < 2 {
+		return ""
+	}
+	return " type"
+}
+
+// dateKeyOf returns the output line of a date and RR type
+func dateKeyOf(rrtypes []uint16, date time.Time, rrtype uint16) dateKey {
+	if len(rrtypes) < 2 {
+		return dateKey{date: date}
+	}
+	return dateKey{date: date, rrtype: rrtype}
+}
+
+// addSelectFlag adds the select command line argument to an analysis command
+func addSelectFlag(cmd *cobra.Command) {
+	cmd.Flags().String(SELECT, SELECT_DEFAULT, SELECT_DESCRIPTION)
+}
+
+// addAllOwnersFlag adds the all owners command line argument to an analysis command
+func addAllOwnersFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool(ALL_OWNERS, false, ALL_OWNERS_DESCRIPTION)
+}
+
+// getSelect checks the select command line argument
+func getSelect() string {
+	var sel = viper.GetString(SELECT)
+	switch sel {
+	case SELECT_MAX, SELECT_MIN, SELECT_KEYTAG:
+		return sel
+	}
+	log.Fatalf("No valid select value was given. Must be one of %s, %s or %s", SELECT_MAX, SELECT_MIN, SELECT_KEYTAG)
+	return ""
+}
+
+// selectSignatures reduces the signatures of every observed RR set.
+// max and min keep the signature with the latest or earliest expiration,
+// keytag keeps the latest expiring signature of every key tag.
+// The order of the signatures is kept.
+func selectSignatures(sigs []storage.Signature, sel string) []storage.Signature {
+	type rrsetKey struct {
+		resolved time.Time
+		tld      string
+		owner    string
+		rrtype   uint16
+		server   string
+		keytag   uint16
+	}
+
+	var index map[rrsetKey]int = make(map[rrsetKey]int, 0)
+	var selected []storage.Signature
+	for _, sig := range sigs {
+		key := rrsetKey{sig.Resolved, sig.TLD, sampleOwner(sig), sig.RRType, sig.Server, 0}
+		if sel == SELECT_KEYTAG {
+			key.keytag = sig.KeyTag
+		}
+
+		i, ok := index[key]
+		if !ok {
+			index[key] = len(selected)
+			selected = append(selected, sig)
+			continue
+		}
+		if sel == SELECT_MIN {
+			if sig.Expiration.Before(selected[i].Expiration) {
+				selected[i] = sig
+			}
+		} else {
+			if sig.Expiration.After(selected[i].Expiration) {
+				selected[i] = sig
+			}
+		}
+	}
+	return selected
+}
+
+// sampleKeyOf returns the sample key of a signature
+func sampleKeyOf(sig storage.Signature, sel string) sampleKey {
+	key := sampleKey{sig.TLD, sampleOwner(sig), sig.RRType, 0, ""}
+	if sel == SELECT_KEYTAG {
+		key.keytag = sig.KeyTag
+	}
+	if sig.Authoritative {
+		key.server = sig.Server
+	}
+	return key
+}
+
+// soaIndex finds the SOA record seen in the probe of a signature.
+// A query failing on one resolver is sent to the next, the SOA record and the
+// signatures of a TLD in one run can come from different resolvers then.
+// Signatures without SOA record from their own server use the SOA record of
+// another server of the same run.
+type soaIndex struct {
+	byProbe   map[storage.Probe]*dns.SOA
+	anyServer map[storage.Probe]*dns.SOA
+}
+
+// newSOAIndex indexes the SOA records by probe
+func newSOAIndex(soas []storage.SOA) soaIndex {
+	index := soaIndex{
+		byProbe:   make(map[storage.Probe]*dns.SOA, 0),
+		anyServer: make(map[storage.Probe]*dns.SOA, 0),
+	}
+	for _, soa := range soas {
+		probe := soa.Probe()
+		index.byProbe[probe] = soa.Record
+		probe.Server = ""
+		index.anyServer[probe] = soa.Record
+	}
+	return index
+}
+
+// of returns the SOA record seen with the signature
+func (index soaIndex) of(sig storage.Signature) (*dns.SOA, bool) {
+	probe := sig.Probe()
+	if soa, ok := index.byProbe[probe]; ok {
+		return soa, true
+	}
+	probe.Server = ""
+	soa, ok := index.anyServer[probe]
+	return soa, ok
+}
+
+// sampleOwner returns the owner name a signature is sampled by.
+// Denial proofs are owned by whatever name covers the random name asked for,
+// all proofs of one type in a probe are one sample.
+func sampleOwner(sig storage.Signature) string {
+	if sig.Proof {
+		return SAMPLE_PROOF
+	}
+	return sig.Owner
+}
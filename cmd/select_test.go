@@ -0,0 +1,75 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+func TestSOAIndex(t *testing.T) {
+	resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	first := testSOA(3600, 1209600, 900)
+	second := testSOA(3600, 604800, 900)
+	index := newSOAIndex([]storage.SOA{
+		{Resolved: resolved, TLD: "se.", Record: first, Server: "192.0.2.1:53", Run: 1},
+		{Resolved: resolved, TLD: "nu.", Record: second, Server: "192.0.2.2:53", Run: 1},
+	})
+
+	tests := []struct {
+		name string
+		sig  storage.Signature
+		want *dns.SOA
+	}{
+		{"same server", storage.Signature{TLD: "se.", Server: "192.0.2.1:53", Run: 1}, first},
+		{"other server of the run", storage.Signature{TLD: "se.", Server: "192.0.2.2:53", Run: 1}, first},
+		{"other TLD", storage.Signature{TLD: "nu.", Server: "192.0.2.1:53", Run: 1}, second},
+		{"other run", storage.Signature{TLD: "se.", Server: "192.0.2.1:53", Run: 2}, nil},
+		{"no TLD", storage.Signature{TLD: "dk.", Server: "192.0.2.1:53", Run: 1}, nil},
+	}
+	for _, test := range tests {
+		soa, ok := index.of(test.sig)
+		if ok != (test.want != nil) || soa != test.want {
+			t.Errorf("%s: got %v %v, want %v", test.name, soa, ok, test.want)
+		}
+	}
+}
+
+func TestSampleKeyOf(t *testing.T) {
+	recursive := storage.Signature{TLD: "se.", RRType: dns.TypeSOA, KeyTag: 12345, Server: "192.0.2.1:53"}
+	failover := recursive
+	failover.Server = "192.0.2.2:53"
+	if sampleKeyOf(recursive, SELECT_MAX) != sampleKeyOf(failover, SELECT_MAX) {
+		t.Errorf("resolvers of a TLD are different samples")
+	}
+
+	ns1 := recursive
+	ns1.Authoritative = true
+	ns2 := failover
+	ns2.Authoritative = true
+	if sampleKeyOf(ns1, SELECT_MAX) == sampleKeyOf(ns2, SELECT_MAX) {
+		t.Errorf("name servers of a TLD are one sample")
+	}
+
+	if key := sampleKeyOf(recursive, SELECT_KEYTAG); key.keytag != 12345 {
+		t.Errorf("got key tag %d, want 12345", key.keytag)
+	}
+}
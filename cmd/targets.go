@@ -0,0 +1,162 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+)
+
+// placeholders in owner name patterns of targets
+const (
+	TARGET_TLD    = "<tld>"    // the TLD measured
+	TARGET_RANDOM = "<random>" // a new random label for every query
+)
+
+// target is an owner name pattern and the RR type queried for it
+type target struct {
+	pattern string
+	rrtype  uint16
+}
+
+// defaultTargets are measured if no targets are given,
+// the random name is answered with a denial of existence
+var defaultTargets = []target{
+	{TARGET_TLD, dns.TypeSOA},
+	{TARGET_TLD, dns.TypeNS},
+	{TARGET_TLD, dns.TypeDNSKEY},
+	{TARGET_TLD, dns.TypeDS},
+	{TARGET_RANDOM + "." + TARGET_TLD, dns.TypeA},
+}
+
+// owner returns the name queried for domain, empty for the domain itself.
+// A random label stays a placeholder, see queryName.
+func (t target) owner(domain string) string {
+	if t.pattern == TARGET_TLD {
+		return ""
+	}
+	return strings.Replace(t.pattern, TARGET_TLD, strings.TrimSuffix(domain, "."), 1) + "."
+}
+
+// queryName returns the name to query for owner in domain
+func queryName(domain string, owner string) string {
+	if owner == "" {
+		return domain
+	}
+	return strings.Replace(owner, TARGET_RANDOM, randomLabel(), 1)
+}
+
+// randomLabel returns a label that should not exist in any zone
+func randomLabel() string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+	label := make([]byte, 20)
+	for i := range label {
+		label[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(label)
+}
+
+// parseTargets reads one target definition: an owner name pattern and one or more RR types.
+// The pattern must end with <tld>, it may contain one <random> label.
+func parseTargets(line string) ([]target, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("target needs owner name and RR type: %s", line)
+	}
+	pattern := strings.ToLower(strings.TrimSuffix(fields[0], "."))
+	if !strings.HasSuffix(pattern, TARGET_TLD) || strings.Count(pattern, TARGET_TLD) != 1 {
+		return nil, fmt.Errorf("owner name %s must end with %s", fields[0], TARGET_TLD)
+	}
+	if strings.Count(pattern, TARGET_RANDOM) > 1 {
+		return nil, fmt.Errorf("owner name %s has more than one %s", fields[0], TARGET_RANDOM)
+	}
+	example := strings.Replace(strings.Replace(pattern, TARGET_RANDOM, "random", 1), TARGET_TLD, "tld", 1)
+	if _, ok := dns.IsDomainName(example); !ok {
+		return nil, fmt.Errorf("owner name %s is not a domain name", fields[0])
+	}
+
+	var targets []target
+	for _, rr := range fields[1:] {
+		rrtype, ok := dns.StringToType[strings.ToUpper(rr)]
+		if !ok {
+			return nil, fmt.Errorf("unknown RR type %s", rr)
+		}
+		targets = append(targets, target{pattern: pattern, rrtype: rrtype})
+	}
+	return targets, nil
+}
+
+// getTargets returns the targets from the configuration, either a list of
+// definitions or the name of a file with one definition per line.
+// Without configuration the SOA, NS, DNSKEY and DS of the TLD and a random name are measured.
+func getTargets() []target {
+	var lines []string
+	switch value := viper.Get(TARGETS).(type) {
+	case nil:
+		return defaultTargets
+	case string:
+		if value == "" {
+			return defaultTargets
+		}
+		fh, err := os.Open(value)
+		if err != nil {
+			log.Fatalf("Could not open target file %s", err)
+		}
+		defer fh.Close()
+		scanner := bufio.NewScanner(fh)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			log.Fatalf("Could not read target file %s", err)
+		}
+	default:
+		lines = viper.GetStringSlice(TARGETS)
+	}
+
+	var targets []target
+	var seen map[target]bool = make(map[target]bool, 0)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list, err := parseTargets(line)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+		for _, t := range list {
+			if !seen[t] {
+				seen[t] = true
+				targets = append(targets, t)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		log.Fatal("No targets found.")
+	}
+	return targets
+}
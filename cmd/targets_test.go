@@ -0,0 +1,133 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		line string
+		want []target
+	}{
+		{"<tld> SOA", []target{{TARGET_TLD, dns.TypeSOA}}},
+		{"<tld>. soa dnskey", []target{{TARGET_TLD, dns.TypeSOA}, {TARGET_TLD, dns.TypeDNSKEY}}},
+		{"NIC.<TLD> A AAAA", []target{{"nic." + TARGET_TLD, dns.TypeA}, {"nic." + TARGET_TLD, dns.TypeAAAA}}},
+		{"<random>.<tld> A", []target{{TARGET_RANDOM + "." + TARGET_TLD, dns.TypeA}}},
+		{"  _dmarc.nic.<tld>\tTXT  ", []target{{"_dmarc.nic." + TARGET_TLD, dns.TypeTXT}}},
+	}
+	for _, test := range tests {
+		got, err := parseTargets(test.line)
+		if err != nil {
+			t.Errorf("%q: %s", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"<tld>",
+		"nic.se A",
+		"<tld>.nic A",
+		"<tld>.<tld> A",
+		"<random>.<random>.<tld> A",
+		"nic..<tld> A",
+		"<tld> NOSUCHTYPE",
+		"<tld> SOA NOSUCHTYPE",
+	}
+	for _, line := range tests {
+		if got, err := parseTargets(line); err == nil {
+			t.Errorf("%q: no error, got %v", line, got)
+		}
+	}
+}
+
+func TestTargetOwner(t *testing.T) {
+	tests := []struct {
+		pattern string
+		domain  string
+		want    string
+	}{
+		{TARGET_TLD, "se.", ""},
+		{"nic." + TARGET_TLD, "se.", "nic.se."},
+		{"nic." + TARGET_TLD, "xn--p1ai.", "nic.xn--p1ai."},
+		{TARGET_RANDOM + "." + TARGET_TLD, "se.", TARGET_RANDOM + ".se."},
+	}
+	for _, test := range tests {
+		if got := (target{pattern: test.pattern}).owner(test.domain); got != test.want {
+			t.Errorf("%s in %s: got %q, want %q", test.pattern, test.domain, got, test.want)
+		}
+	}
+
+	// the random label is new for every query
+	if got := queryName("se.", ""); got != "se." {
+		t.Errorf("query name of the TLD is %s", got)
+	}
+	if got := queryName("se.", "nic.se."); got != "nic.se." {
+		t.Errorf("query name of nic.se. is %s", got)
+	}
+	first, second := queryName("se.", TARGET_RANDOM+".se."), queryName("se.", TARGET_RANDOM+".se.")
+	if strings.Contains(first, TARGET_RANDOM) || !strings.HasSuffix(first, ".se.") || first == second {
+		t.Errorf("random query names are %s and %s", first, second)
+	}
+	if _, ok := dns.IsDomainName(first); !ok {
+		t.Errorf("%s is not a domain name", first)
+	}
+}
+
+func TestGetTargets(t *testing.T) {
+	defer viper.Set(TARGETS, nil)
+
+	// no configuration
+	viper.Set(TARGETS, "")
+	if got := getTargets(); !reflect.DeepEqual(got, defaultTargets) {
+		t.Errorf("without targets got %v", got)
+	}
+
+	// a file with comments, blank lines and duplicates
+	filename := filepath.Join(t.TempDir(), "targets.txt")
+	data := "# targets\n\n<tld> SOA DNSKEY\n   \n  # nic\nnic.<tld> A AAAA\n<tld> SOA\n"
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set(TARGETS, filename)
+	want := []target{{TARGET_TLD, dns.TypeSOA}, {TARGET_TLD, dns.TypeDNSKEY}, {"nic." + TARGET_TLD, dns.TypeA}, {"nic." + TARGET_TLD, dns.TypeAAAA}}
+	if got := getTargets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("file: got %v, want %v", got, want)
+	}
+
+	// a list in the configuration file
+	viper.Set(TARGETS, []interface{}{"<tld> SOA", "# comment", "<random>.<tld> A"})
+	want = []target{{TARGET_TLD, dns.TypeSOA}, {TARGET_RANDOM + "." + TARGET_TLD, dns.TypeA}}
+	if got := getTargets(); !reflect.DeepEqual(got, want) {
+		t.Errorf("list: got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/viper"
+)
+
+// transports to query a server
+const (
+	TRANSPORT_UDP   = "udp"   // UDP, truncated answers are repeated over TCP
+	TRANSPORT_TCP   = "tcp"   // TCP
+	TRANSPORT_TLS   = "tls"   // DNS over TLS (RFC 7858)
+	TRANSPORT_HTTPS = "https" // DNS over HTTPS (RFC 8484)
+)
+
+// default ports of the transports
+var transportPorts = map[string]string{
+	TRANSPORT_UDP: "53",
+	TRANSPORT_TCP: "53",
+	TRANSPORT_TLS: "853",
+}
+
+// server is a resolver or name server and the transport used to query it
+type server struct {
+	transport string
+	address   string // host:port, the URL for DNS over HTTPS
+}
+
+// String returns the server as URI
+func (s server) String() string {
+	if s.transport == TRANSPORT_HTTPS {
+		return s.address
+	}
+	return s.transport + "://" + s.address
+}
+
+// tcpServer returns a server queried over TCP, name servers are always queried over TCP
+func tcpServer(address string) server {
+	return server{transport: TRANSPORT_TCP, address: address}
+}
+
+// parseServer reads a resolver given as IP address (queried over TCP) or as URI like
+// udp://192.0.2.1, tcp://[2001:db8::1]:5353, tls://9.9.9.9 or https://host/dns-query
+func parseServer(uri string) (server, error) {
+	if ip := net.ParseIP(uri); ip != nil {
+		return tcpServer(serverAddress(ip)), nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return server{}, err
+	}
+	if u.Hostname() == "" {
+		return server{}, fmt.Errorf("no host in %s", uri)
+	}
+	switch u.Scheme {
+	case TRANSPORT_HTTPS:
+		return server{transport: TRANSPORT_HTTPS, address: u.String()}, nil
+	case TRANSPORT_UDP, TRANSPORT_TCP, TRANSPORT_TLS:
+		if u.Path != "" || u.RawQuery != "" {
+			return server{}, fmt.Errorf("%s must not have a path", uri)
+		}
+		port := u.Port()
+		if port == "" {
+			port = transportPorts[u.Scheme]
+		}
+		return server{transport: u.Scheme, address: net.JoinHostPort(u.Hostname(), port)}, nil
+	}
+	return server{}, fmt.Errorf("unknown transport %s in %s", u.Scheme, uri)
+}
+
+// exchange sends one query to the server
+func (s server) exchange(query *dns.Msg) (*dns.Msg, error) {
+	if s.transport == TRANSPORT_HTTPS {
+		return dohExchange(query, s.address)
+	}
+	client := new(dns.Client)
+	client.Timeout = viper.GetDuration(TIMEOUT)
+	switch s.transport {
+	case TRANSPORT_TCP:
+		client.Net = "tcp"
+	case TRANSPORT_TLS:
+		client.Net = "tcp-tls"
+	default:
+		client.Net = "udp"
+	}
+	r, _, err := client.Exchange(query, s.address)
+	return r, err
+}
+
+// dohClient keeps connections to DNS over HTTPS servers open between queries
+var dohClient = &http.Client{}
+
+// dohExchange sends a query with POST to a DNS over HTTPS server
+func dohExchange(query *dns.Msg, uri string) (*dns.Msg, error) {
+	// RFC 8484 4.1: the ID should be 0 so answers can be cached
+	m := query.Copy()
+	m.Id = 0
+	wire, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration(TIMEOUT))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(wire))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", uri, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, err
+	}
+	// without an ID to match, the question must be the one asked
+	if len(r.Question) != len(query.Question) {
+		return nil, fmt.Errorf("%s answered %d questions, %d were asked", uri, len(r.Question), len(query.Question))
+	}
+	for i, q := range query.Question {
+		if !strings.EqualFold(r.Question[i].Name, q.Name) || r.Question[i].Qtype != q.Qtype || r.Question[i].Qclass != q.Qclass {
+			return nil, fmt.Errorf("%s answered %s %s, %s %s was asked", uri, r.Question[i].Name, dns.TypeToString[r.Question[i].Qtype], q.Name, dns.TypeToString[q.Qtype])
+		}
+	}
+	r.Id = query.Id
+	return r, nil
+}
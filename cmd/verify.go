@@ -0,0 +1,199 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/apex/log"
+
+	"github.com/ulrichwisser/dnssectiming/storage"
+)
+
+// verifyCmd validates stored signatures against the stored DNSKEY sets
+var verifyCmd = &cobra.Command{
+	Use:     "verify [--tld <name>] [--rr <type>[,<type>...]]",
+	Version: "0.0.1a",
+	Short:   "validate stored signatures offline",
+	Long: `validate stored signatures offline
+
+Every stored RR set is validated with the DNSKEY set of the signer seen on the same day.
+Reported are bogus signatures, signatures made with an unknown key tag and
+signatures that were resolved outside of their inception/expiration window.
+DS records are signed by the parent, they can only be validated if the parent
+zone is part of the measured domain list.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// debug command line arguments
+		log.Debug("Flags:")
+		cmd.Flags().VisitAll(func(f *pflag.Flag) { log.Debugf("  %s = %s (changed=%v)\n", f.Name, f.Value, f.Changed) })
+
+		// now run the command
+		verifyRun(args)
+	},
+}
+
+func init() {
+	// add the command to cobra
+	rootCmd.AddCommand(verifyCmd)
+
+	// define command line arguments
+	addRunFlags(verifyCmd)
+}
+
+// results of the validation of one signature
+const (
+	VERIFY_VALID   = "valid"
+	VERIFY_BOGUS   = "bogus"
+	VERIFY_UNKNOWN = "unknown-keytag"
+	VERIFY_WINDOW  = "outside-window"
+	VERIFY_NOSIG   = "no-signature"
+	VERIFY_NOKEYS  = "no-dnskey"
+)
+
+func verifyRun(args []string) {
+
+	// check TLD command line argument, verify all TLD if not given
+	// every RR set is verified, whatever its owner name
+	var filter = storage.Filter{AllOwners: true}
+	if tld := viper.GetString(TLD); tld != "" {
+		filter.TLD = dns.Fqdn(tld)
+	}
+
+	// check RR command line argument, verify all types if not given
+	filter.RRTypes = getRRTypes(false)
+
+	// open database
+	store := openStore()
+	defer store.Close()
+
+	// select runs
+	filter.Runs = getRuns(store)
+
+	//
+	// Get DNSKEY sets by day and TLD
+	//
+	dnskeyData, err := store.RRSets(storage.Filter{RRType: dns.TypeDNSKEY, Runs: filter.Runs})
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var keysByDayTLD map[time.Time]map[string][]*dns.DNSKEY = make(map[time.Time]map[string][]*dns.DNSKEY, 0)
+	for _, rrset := range dnskeyData {
+		rrs, err := rrset.RRs()
+		if err != nil {
+			log.Fatalf("%s %s DNSKEY %s", rrset.Resolved.Format(time.DateOnly), rrset.TLD, err)
+		}
+
+		// prepare data structure
+		day := normalizeDay(rrset.Resolved.UTC())
+		if _, ok := keysByDayTLD[day]; !ok {
+			keysByDayTLD[day] = make(map[string][]*dns.DNSKEY, 0)
+		}
+
+		// save data
+		for _, rr := range rrs {
+			if key, ok := rr.(*dns.DNSKEY); ok {
+				keysByDayTLD[day][rrset.TLD] = append(keysByDayTLD[day][rrset.TLD], key)
+			}
+		}
+	}
+
+	//
+	// Validate signatures
+	//
+	rrData, err := store.RRSets(filter)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	var count map[string]int = make(map[string]int, 0)
+	for _, rrset := range rrData {
+		rrs, err := rrset.RRs()
+		if err != nil {
+			log.Fatalf("%s %s %s %s", rrset.Resolved.Format(time.DateOnly), rrset.TLD, dns.TypeToString[rrset.RRType], err)
+		}
+		if len(rrs) == 0 {
+			continue
+		}
+		day := normalizeDay(rrset.Resolved.UTC())
+
+		for _, sig := range rrset.Signatures {
+			// signatures stored before schema version 2 have no signer
+			signer := strings.ToLower(sig.SignerName)
+			if signer == "" {
+				signer = rrset.TLD
+			}
+			keys, ok := keysByDayTLD[day][signer]
+			if !ok {
+				count[VERIFY_NOKEYS]++
+				fmt.Printf("%s %s %s %d %s\n", rrset.Resolved.Format(time.DateTime), rrset.TLD, dns.TypeToString[rrset.RRType], sig.KeyTag, VERIFY_NOKEYS)
+				continue
+			}
+			for _, result := range verifySignature(sig, rrs, keys) {
+				count[result]++
+				if result == VERIFY_VALID {
+					continue
+				}
+				fmt.Printf("%s %s %s %d %s\n", rrset.Resolved.Format(time.DateTime), rrset.TLD, dns.TypeToString[rrset.RRType], sig.KeyTag, result)
+			}
+		}
+	}
+
+	// summary as gnuplot comment
+	for _, result := range []string{VERIFY_VALID, VERIFY_BOGUS, VERIFY_UNKNOWN, VERIFY_WINDOW, VERIFY_NOSIG, VERIFY_NOKEYS} {
+		fmt.Printf("# %s %d\n", result, count[result])
+	}
+}
+
+// verifySignature validates one signature of rrs with the matching key.
+// A signature can be valid and resolved outside its validity window at the same time.
+func verifySignature(sig storage.Signature, rrs []dns.RR, keys []*dns.DNSKEY) []string {
+	if sig.Signature == "" {
+		return []string{VERIFY_NOSIG}
+	}
+	rrsig := sig.RRSIG(rrs[0].Header().Name)
+
+	var results []string
+	if !rrsig.ValidityPeriod(sig.Resolved) {
+		results = append(results, VERIFY_WINDOW)
+	}
+
+	var found bool
+	for _, key := range keys {
+		if key.KeyTag() != rrsig.KeyTag || key.Algorithm != rrsig.Algorithm || !strings.EqualFold(key.Header().Name, rrsig.SignerName) {
+			continue
+		}
+		found = true
+		err := rrsig.Verify(key, rrs)
+		if err == nil {
+			return append(results, VERIFY_VALID)
+		}
+		log.Debugf("%s %s keytag %d: %s", sig.TLD, dns.TypeToString[sig.RRType], sig.KeyTag, err)
+	}
+	if !found {
+		return append(results, VERIFY_UNKNOWN)
+	}
+	return append(results, VERIFY_BOGUS)
+}
@@ -5,6 +5,7 @@ go 1.16
 require (
 	github.com/apex/log v1.9.0
 	github.com/go-sql-driver/mysql v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/miekg/dns v1.1.26
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.2.1
@@ -0,0 +1,26 @@
+-- Initial schema as used by measure and the analysis commands.
+--
+-- RRDATA holds every distinct RR set exactly once, keyed by the SHA256 of
+-- its normalized text representation. RRSIG holds one row per observed
+-- signature and references the RR set it covers.
+
+CREATE TABLE IF NOT EXISTS RRDATA (
+    SHA256     CHAR(64)          NOT NULL,
+    RRDATA     MEDIUMTEXT        NOT NULL,
+    PRIMARY KEY (SHA256)
+);
+
+CREATE TABLE IF NOT EXISTS RRSIG (
+    ID         BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    RESOLVED   DATETIME          NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    TLD        VARCHAR(255)      NOT NULL,
+    RRTYPE     SMALLINT UNSIGNED NOT NULL,
+    SHA256     CHAR(64)          NOT NULL,
+    INCEPTION  DATETIME          NOT NULL,
+    EXPIRATION DATETIME          NOT NULL,
+    SIG        TEXT              NOT NULL,
+    PRIMARY KEY (ID),
+    KEY RRSIG_RRTYPE_RESOLVED (RRTYPE, RESOLVED, TLD),
+    KEY RRSIG_TLD_RRTYPE (TLD, RRTYPE, RESOLVED),
+    KEY RRSIG_SHA256 (SHA256)
+);
@@ -0,0 +1,9 @@
+-- Every RRSIG of an answer is stored, not only the one with the latest
+-- expiration. The columns are NULL for rows written before this version.
+
+ALTER TABLE RRSIG
+    ADD COLUMN KEYTAG    SMALLINT UNSIGNED NULL,
+    ADD COLUMN ALGORITHM TINYINT UNSIGNED  NULL,
+    ADD COLUMN SIGNER    VARCHAR(255)      NULL,
+    ADD COLUMN LABELS    TINYINT UNSIGNED  NULL,
+    ADD COLUMN ORIGTTL   INT UNSIGNED      NULL;
@@ -0,0 +1,6 @@
+-- Observations are stored per server. SERVER is the resolver or, in
+-- authoritative mode, the name server of the TLD that was queried.
+
+ALTER TABLE RRSIG
+    ADD COLUMN SERVER        VARCHAR(255) NULL,
+    ADD COLUMN AUTHORITATIVE TINYINT      NOT NULL DEFAULT 0;
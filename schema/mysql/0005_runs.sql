@@ -0,0 +1,27 @@
+-- Every execution of measure is a run. RUNS records when it started and
+-- finished, the resolvers used and the SHA256 of the domain list.
+-- A run without FINISHED was interrupted and is partial.
+-- RUN_COUNTS holds the number of saved and failed queries per RR type.
+-- Observations stored before schema version 5 have no run.
+
+CREATE TABLE IF NOT EXISTS RUNS (
+    ID         BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    STARTED    DATETIME          NOT NULL,
+    FINISHED   DATETIME          NULL,
+    RESOLVERS  TEXT              NOT NULL,
+    INPUTHASH  CHAR(64)          NOT NULL,
+    PRIMARY KEY (ID),
+    KEY RUNS_STARTED (STARTED)
+);
+
+CREATE TABLE IF NOT EXISTS RUN_COUNTS (
+    RUN        BIGINT UNSIGNED   NOT NULL,
+    RRTYPE     SMALLINT UNSIGNED NOT NULL,
+    SUCCESS    INT UNSIGNED      NOT NULL DEFAULT 0,
+    FAILURE    INT UNSIGNED      NOT NULL DEFAULT 0,
+    PRIMARY KEY (RUN, RRTYPE)
+);
+
+ALTER TABLE RRSIG
+    ADD COLUMN RUN BIGINT UNSIGNED NULL,
+    ADD KEY RRSIG_RUN (RUN, TLD);
@@ -0,0 +1,11 @@
+-- CHECKPOINTS holds every query of a run that got an answer, so an
+-- interrupted run can be resumed. SERVER is empty unless the name servers
+-- of the TLD were queried directly.
+
+CREATE TABLE IF NOT EXISTS CHECKPOINTS (
+    RUN        BIGINT UNSIGNED   NOT NULL,
+    TLD        VARCHAR(255)      NOT NULL,
+    RRTYPE     SMALLINT UNSIGNED NOT NULL,
+    SERVER     VARCHAR(255)      NOT NULL DEFAULT '',
+    PRIMARY KEY (RUN, TLD, RRTYPE, SERVER)
+);
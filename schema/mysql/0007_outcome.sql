@@ -0,0 +1,5 @@
+-- CHECKPOINTS now holds the final outcome of every query of a run,
+-- failed queries included. Only failed queries are sent again on resume.
+
+ALTER TABLE CHECKPOINTS
+    ADD COLUMN OUTCOME VARCHAR(16) NOT NULL DEFAULT 'ok';
@@ -0,0 +1,22 @@
+-- QUERY_RESULT holds every query sent by measure, retries included.
+-- RCODE is NULL if there was no answer, EDE is the first extended DNS error
+-- code of the answer. OUTCOME of the last attempt of a query is its final
+-- outcome, e.g. unsigned if a NOERROR answer had no signature.
+
+CREATE TABLE IF NOT EXISTS QUERY_RESULT (
+    ID            BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    RUN           BIGINT UNSIGNED   NULL,
+    TLD           VARCHAR(255)      NOT NULL,
+    RRTYPE        SMALLINT UNSIGNED NOT NULL,
+    SERVER        VARCHAR(255)      NOT NULL,
+    AUTHORITATIVE TINYINT           NOT NULL DEFAULT 0,
+    ATTEMPT       INT UNSIGNED      NOT NULL,
+    SENT          DATETIME          NOT NULL,
+    LATENCY       INT UNSIGNED      NOT NULL,
+    RCODE         SMALLINT UNSIGNED NULL,
+    OUTCOME       VARCHAR(16)       NOT NULL,
+    EDE           SMALLINT UNSIGNED NULL,
+    PRIMARY KEY (ID),
+    KEY QUERY_RESULT_RUN (RUN, TLD),
+    KEY QUERY_RESULT_SENT (SENT, TLD)
+);
@@ -0,0 +1,11 @@
+-- EXTENDED_ERROR holds every extended DNS error (RFC 8914) of an answer
+-- with its extra text. QUERY references QUERY_RESULT.ID.
+
+CREATE TABLE IF NOT EXISTS EXTENDED_ERROR (
+    ID         BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    QUERY      BIGINT UNSIGNED   NOT NULL,
+    CODE       SMALLINT UNSIGNED NOT NULL,
+    TEXT       TEXT              NOT NULL,
+    PRIMARY KEY (ID),
+    KEY EXTENDED_ERROR_QUERY (QUERY)
+);
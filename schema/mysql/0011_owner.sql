@@ -0,0 +1,11 @@
+-- Targets below the TLD apex (like nic.<tld>) have an owner name.
+-- OWNER is empty for the TLD itself, as for everything measured before.
+
+ALTER TABLE RRSIG ADD COLUMN OWNER VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE QUERY_RESULT ADD COLUMN OWNER VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE CHECKPOINTS
+    ADD COLUMN OWNER VARCHAR(255) NOT NULL DEFAULT '',
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (RUN, TLD, OWNER, RRTYPE, SERVER);
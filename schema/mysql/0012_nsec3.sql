@@ -0,0 +1,16 @@
+-- NSEC3 holds the NSEC3 parameters (RFC 5155) of every denial of existence.
+
+CREATE TABLE IF NOT EXISTS NSEC3 (
+    ID            BIGINT UNSIGNED   NOT NULL AUTO_INCREMENT,
+    RESOLVED      DATETIME          NOT NULL,
+    TLD           VARCHAR(255)      NOT NULL,
+    SERVER        VARCHAR(255)      NOT NULL DEFAULT '',
+    AUTHORITATIVE TINYINT           NOT NULL DEFAULT 0,
+    RUN           BIGINT UNSIGNED   NULL,
+    HASH          TINYINT UNSIGNED  NOT NULL,
+    OPTOUT        TINYINT           NOT NULL,
+    ITERATIONS    SMALLINT UNSIGNED NOT NULL,
+    SALT          VARCHAR(510)      NOT NULL DEFAULT '',
+    PRIMARY KEY (ID),
+    KEY NSEC3_RUN (RUN, TLD)
+);
@@ -0,0 +1,253 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package schema contains the versioned database migrations of dnssectiming.
+//
+// Every migration is a SQL file named <version>_<name>.sql in the directory
+// of its SQL dialect. Both dialects must provide the same versions.
+// Migrations are applied in version order and every applied version is
+// recorded in the SCHEMA_VERSION table.
+package schema
+
+import (
+	"bufio"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed mysql/*.sql sqlite/*.sql
+var migrationFiles embed.FS
+
+// supported SQL dialects
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+)
+
+const versionTable = `CREATE TABLE IF NOT EXISTS SCHEMA_VERSION (
+    VERSION    INT          NOT NULL,
+    NAME       VARCHAR(255) NOT NULL,
+    APPLIED    DATETIME     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (VERSION)
+)`
+
+// Migration is one step of the database schema.
+type Migration struct {
+	Version    int
+	Name       string
+	Statements []string
+}
+
+// Applied describes a migration that has been recorded in the database.
+type Applied struct {
+	Version int
+	Name    string
+	Applied time.Time
+}
+
+// Migrations returns all known migrations for the dialect sorted by version.
+func Migrations(dialect string) ([]Migration, error) {
+	files, err := migrationFiles.ReadDir(dialect)
+	if err != nil {
+		return nil, fmt.Errorf("unknown SQL dialect %s", dialect)
+	}
+
+	var migrations []Migration
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".sql") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s is not named <version>_<name>.sql", f.Name())
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no valid version: %s", f.Name(), err)
+		}
+		data, err := migrationFiles.ReadFile(path.Join(dialect, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: parts[1], Statements: splitStatements(string(data))})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("migration version %d is used twice", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version the database must have to be usable.
+func Latest(dialect string) (int, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// History returns all migrations recorded in the database.
+// An empty list is returned if the database has never been initialised.
+func History(db *sql.DB, dialect string) ([]Applied, error) {
+	exists, err := tableExists(db, dialect, "SCHEMA_VERSION")
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := db.Query("SELECT VERSION,NAME,APPLIED FROM SCHEMA_VERSION ORDER BY VERSION")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []Applied
+	for rows.Next() {
+		var a Applied
+		if err := rows.Scan(&a.Version, &a.Name, &a.Applied); err != nil {
+			return nil, err
+		}
+		history = append(history, a)
+	}
+	return history, rows.Err()
+}
+
+// Current returns the schema version of the database, 0 if it was never initialised.
+func Current(db *sql.DB, dialect string) (int, error) {
+	history, err := History(db, dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(history) == 0 {
+		return 0, nil
+	}
+	return history[len(history)-1].Version, nil
+}
+
+// Check returns an error if the database schema is not at the latest version.
+func Check(db *sql.DB, dialect string) error {
+	current, err := Current(db, dialect)
+	if err != nil {
+		return err
+	}
+	latest, err := Latest(dialect)
+	if err != nil {
+		return err
+	}
+	if current != latest {
+		return fmt.Errorf("database schema version is %d, expected %d", current, latest)
+	}
+	return nil
+}
+
+// Migrate applies all migrations newer than the current schema version
+// and returns the list of applied migrations.
+func Migrate(db *sql.DB, dialect string) ([]Migration, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(versionTable); err != nil {
+		return nil, fmt.Errorf("could not create SCHEMA_VERSION: %s", err)
+	}
+	current, err := Current(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		// MySQL commits DDL implicitly, therefore statements are run one by one
+		// and the version is only recorded after all of them succeeded.
+		for _, stmt := range m.Statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return applied, fmt.Errorf("migration %04d_%s failed: %s", m.Version, m.Name, err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO SCHEMA_VERSION(VERSION,NAME) VALUES(?,?)", m.Version, m.Name); err != nil {
+			return applied, fmt.Errorf("could not record migration %04d_%s: %s", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+func tableExists(db *sql.DB, dialect string, table string) (bool, error) {
+	var query string
+	switch dialect {
+	case MySQL:
+		query = "SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME=?"
+	case SQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name=?"
+	default:
+		return false, fmt.Errorf("unknown SQL dialect %s", dialect)
+	}
+	var count int
+	err := db.QueryRow(query, table).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// splitStatements splits a migration file into single statements.
+// Statements end with a semicolon at the end of a line, lines starting with -- are comments.
+func splitStatements(data string) []string {
+	var statements []string
+	var stmt strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		if strings.HasSuffix(line, ";") {
+			stmt.WriteString(strings.TrimSuffix(line, ";"))
+			if s := strings.TrimSpace(stmt.String()); s != "" {
+				statements = append(statements, s)
+			}
+			stmt.Reset()
+			continue
+		}
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		statements = append(statements, s)
+	}
+	return statements
+}
@@ -0,0 +1,25 @@
+-- Initial schema as used by measure and the analysis commands.
+--
+-- RRDATA holds every distinct RR set exactly once, keyed by the SHA256 of
+-- its normalized text representation. RRSIG holds one row per observed
+-- signature and references the RR set it covers.
+
+CREATE TABLE IF NOT EXISTS RRDATA (
+    SHA256     TEXT     NOT NULL PRIMARY KEY,
+    RRDATA     TEXT     NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS RRSIG (
+    ID         INTEGER  PRIMARY KEY AUTOINCREMENT,
+    RESOLVED   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    TLD        TEXT     NOT NULL,
+    RRTYPE     INTEGER  NOT NULL,
+    SHA256     TEXT     NOT NULL,
+    INCEPTION  DATETIME NOT NULL,
+    EXPIRATION DATETIME NOT NULL,
+    SIG        TEXT     NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS RRSIG_RRTYPE_RESOLVED ON RRSIG(RRTYPE, RESOLVED, TLD);
+CREATE INDEX IF NOT EXISTS RRSIG_TLD_RRTYPE ON RRSIG(TLD, RRTYPE, RESOLVED);
+CREATE INDEX IF NOT EXISTS RRSIG_SHA256 ON RRSIG(SHA256);
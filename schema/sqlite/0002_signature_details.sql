@@ -0,0 +1,8 @@
+-- Every RRSIG of an answer is stored, not only the one with the latest
+-- expiration. The columns are NULL for rows written before this version.
+
+ALTER TABLE RRSIG ADD COLUMN KEYTAG    INTEGER NULL;
+ALTER TABLE RRSIG ADD COLUMN ALGORITHM INTEGER NULL;
+ALTER TABLE RRSIG ADD COLUMN SIGNER    TEXT    NULL;
+ALTER TABLE RRSIG ADD COLUMN LABELS    INTEGER NULL;
+ALTER TABLE RRSIG ADD COLUMN ORIGTTL   INTEGER NULL;
@@ -0,0 +1,5 @@
+-- RRDATA is stored with the original TTL of the RRSIG. The TTL seen in the
+-- answer is the decremented cache TTL of the resolver and is kept here.
+-- Rows written before this version have no TTL until 'db rekey' is run.
+
+ALTER TABLE RRSIG ADD COLUMN TTL INTEGER NULL;
@@ -0,0 +1,5 @@
+-- Observations are stored per server. SERVER is the resolver or, in
+-- authoritative mode, the name server of the TLD that was queried.
+
+ALTER TABLE RRSIG ADD COLUMN SERVER        TEXT    NULL;
+ALTER TABLE RRSIG ADD COLUMN AUTHORITATIVE INTEGER NOT NULL DEFAULT 0;
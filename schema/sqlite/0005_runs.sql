@@ -0,0 +1,27 @@
+-- Every execution of measure is a run. RUNS records when it started and
+-- finished, the resolvers used and the SHA256 of the domain list.
+-- A run without FINISHED was interrupted and is partial.
+-- RUN_COUNTS holds the number of saved and failed queries per RR type.
+-- Observations stored before schema version 5 have no run.
+
+CREATE TABLE IF NOT EXISTS RUNS (
+    ID         INTEGER  PRIMARY KEY AUTOINCREMENT,
+    STARTED    DATETIME NOT NULL,
+    FINISHED   DATETIME NULL,
+    RESOLVERS  TEXT     NOT NULL,
+    INPUTHASH  TEXT     NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS RUNS_STARTED ON RUNS(STARTED);
+
+CREATE TABLE IF NOT EXISTS RUN_COUNTS (
+    RUN        INTEGER  NOT NULL,
+    RRTYPE     INTEGER  NOT NULL,
+    SUCCESS    INTEGER  NOT NULL DEFAULT 0,
+    FAILURE    INTEGER  NOT NULL DEFAULT 0,
+    PRIMARY KEY (RUN, RRTYPE)
+);
+
+ALTER TABLE RRSIG ADD COLUMN RUN INTEGER NULL;
+
+CREATE INDEX IF NOT EXISTS RRSIG_RUN ON RRSIG(RUN, TLD);
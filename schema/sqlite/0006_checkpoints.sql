@@ -0,0 +1,11 @@
+-- CHECKPOINTS holds every query of a run that got an answer, so an
+-- interrupted run can be resumed. SERVER is empty unless the name servers
+-- of the TLD were queried directly.
+
+CREATE TABLE IF NOT EXISTS CHECKPOINTS (
+    RUN        INTEGER  NOT NULL,
+    TLD        TEXT     NOT NULL,
+    RRTYPE     INTEGER  NOT NULL,
+    SERVER     TEXT     NOT NULL DEFAULT '',
+    PRIMARY KEY (RUN, TLD, RRTYPE, SERVER)
+);
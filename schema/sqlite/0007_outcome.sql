@@ -0,0 +1,4 @@
+-- CHECKPOINTS now holds the final outcome of every query of a run,
+-- failed queries included. Only failed queries are sent again on resume.
+
+ALTER TABLE CHECKPOINTS ADD COLUMN OUTCOME TEXT NOT NULL DEFAULT 'ok';
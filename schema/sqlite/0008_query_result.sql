@@ -0,0 +1,22 @@
+-- QUERY_RESULT holds every query sent by measure, retries included.
+-- RCODE is NULL if there was no answer, EDE is the first extended DNS error
+-- code of the answer. OUTCOME of the last attempt of a query is its final
+-- outcome, e.g. unsigned if a NOERROR answer had no signature.
+
+CREATE TABLE IF NOT EXISTS QUERY_RESULT (
+    ID            INTEGER  PRIMARY KEY AUTOINCREMENT,
+    RUN           INTEGER  NULL,
+    TLD           TEXT     NOT NULL,
+    RRTYPE        INTEGER  NOT NULL,
+    SERVER        TEXT     NOT NULL,
+    AUTHORITATIVE INTEGER  NOT NULL DEFAULT 0,
+    ATTEMPT       INTEGER  NOT NULL,
+    SENT          DATETIME NOT NULL,
+    LATENCY       INTEGER  NOT NULL,
+    RCODE         INTEGER  NULL,
+    OUTCOME       TEXT     NOT NULL,
+    EDE           INTEGER  NULL
+);
+
+CREATE INDEX IF NOT EXISTS QUERY_RESULT_RUN ON QUERY_RESULT(RUN, TLD);
+CREATE INDEX IF NOT EXISTS QUERY_RESULT_SENT ON QUERY_RESULT(SENT, TLD);
@@ -0,0 +1,11 @@
+-- EXTENDED_ERROR holds every extended DNS error (RFC 8914) of an answer
+-- with its extra text. QUERY references QUERY_RESULT.ID.
+
+CREATE TABLE IF NOT EXISTS EXTENDED_ERROR (
+    ID         INTEGER  PRIMARY KEY AUTOINCREMENT,
+    QUERY      INTEGER  NOT NULL,
+    CODE       INTEGER  NOT NULL,
+    TEXT       TEXT     NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS EXTENDED_ERROR_QUERY ON EXTENDED_ERROR(QUERY);
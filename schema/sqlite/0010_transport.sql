@@ -0,0 +1,6 @@
+-- The transport (udp, tcp, tls or https) used for every query.
+-- Everything measured before was sent over TCP.
+
+ALTER TABLE RRSIG ADD COLUMN TRANSPORT TEXT NOT NULL DEFAULT 'tcp';
+
+ALTER TABLE QUERY_RESULT ADD COLUMN TRANSPORT TEXT NOT NULL DEFAULT 'tcp';
@@ -0,0 +1,23 @@
+-- Targets below the TLD apex (like nic.<tld>) have an owner name.
+-- OWNER is empty for the TLD itself, as for everything measured before.
+
+ALTER TABLE RRSIG ADD COLUMN OWNER TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE QUERY_RESULT ADD COLUMN OWNER TEXT NOT NULL DEFAULT '';
+
+-- SQLite can not change a primary key, CHECKPOINTS is copied
+CREATE TABLE CHECKPOINTS_OWNER (
+    RUN        INTEGER  NOT NULL,
+    TLD        TEXT     NOT NULL,
+    OWNER      TEXT     NOT NULL DEFAULT '',
+    RRTYPE     INTEGER  NOT NULL,
+    SERVER     TEXT     NOT NULL DEFAULT '',
+    OUTCOME    TEXT     NOT NULL DEFAULT 'ok',
+    PRIMARY KEY (RUN, TLD, OWNER, RRTYPE, SERVER)
+);
+
+INSERT INTO CHECKPOINTS_OWNER(RUN,TLD,RRTYPE,SERVER,OUTCOME) SELECT RUN,TLD,RRTYPE,SERVER,OUTCOME FROM CHECKPOINTS;
+
+DROP TABLE CHECKPOINTS;
+
+ALTER TABLE CHECKPOINTS_OWNER RENAME TO CHECKPOINTS;
@@ -0,0 +1,16 @@
+-- NSEC3 holds the NSEC3 parameters (RFC 5155) of every denial of existence.
+
+CREATE TABLE IF NOT EXISTS NSEC3 (
+    ID            INTEGER  PRIMARY KEY AUTOINCREMENT,
+    RESOLVED      DATETIME NOT NULL,
+    TLD           TEXT     NOT NULL,
+    SERVER        TEXT     NOT NULL DEFAULT '',
+    AUTHORITATIVE INTEGER  NOT NULL DEFAULT 0,
+    RUN           INTEGER  NULL,
+    HASH          INTEGER  NOT NULL,
+    OPTOUT        INTEGER  NOT NULL,
+    ITERATIONS    INTEGER  NOT NULL,
+    SALT          TEXT     NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS NSEC3_RUN ON NSEC3(RUN, TLD);
@@ -0,0 +1,9 @@
+-- PROOF marks the NSEC, NSEC3 and SOA RR sets of the authority section of
+-- negative answers. OWNER is now the owner name of the proof record, the
+-- queried name is kept in CHECKPOINTS and QUERY_RESULT.
+-- Proofs measured before were saved under the queried name, like <random>.<tld>,
+-- only those are marked. NSEC, NSEC3 and SOA RR sets queried for are no proofs.
+
+ALTER TABLE RRSIG ADD COLUMN PROOF INTEGER NOT NULL DEFAULT 0;
+
+UPDATE RRSIG SET PROOF=1 WHERE OWNER LIKE '%<random>%';
@@ -0,0 +1,59 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/ulrichwisser/dnssectiming/schema"
+)
+
+// openMySQL opens a MySQL database, dsn is in the format of the go-sql-driver
+func openMySQL(dsn string) (*sqlStore, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse MySQL DSN %s", err)
+	}
+	// DATETIME columns are scanned into time.Time and are always in UTC
+	cfg.ParseTime = true
+	cfg.Loc = time.UTC
+
+	db, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{
+		db:           db,
+		dialect:      schema.MySQL,
+		insertIgnore: "INSERT IGNORE",
+		transient:    mysqlTransient,
+	}, nil
+}
+
+// mysqlTransient reports deadlocks, lock wait timeouts and lost connections
+func mysqlTransient(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1205 || mysqlErr.Number == 1213
+	}
+	return errors.Is(err, mysql.ErrInvalidConn)
+}
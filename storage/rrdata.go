@@ -0,0 +1,42 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// NormalizeRRSet returns the text representation of an RR set as stored in RRDATA.
+//
+// All records get the same TTL, which should be the original TTL of the RRSIG.
+// Owner names are lower cased and records are sorted, resolvers answer with
+// round robin data and may randomize the case of names.
+// Identical RR sets therefore always get the same SHA256 key.
+func NormalizeRRSet(rrs []dns.RR, ttl uint32) string {
+	var lines []string
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		rr.Header().Name = strings.ToLower(rr.Header().Name)
+		rr.Header().Ttl = ttl
+		lines = append(lines, rr.String())
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,127 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+func (s *sqlStore) StartRun(r Run) (int64, error) {
+	res, err := s.db.Exec("INSERT INTO RUNS(STARTED,RESOLVERS,INPUTHASH) VALUES(?,?,?)", dbTime(r.Started), strings.Join(r.Resolvers, ","), r.InputHash)
+	if err != nil {
+		return 0, fmt.Errorf("writing to RUNS failed %s", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("could not get run ID %s", err)
+	}
+	return id, nil
+}
+
+func (s *sqlStore) FinishRun(r Run) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start DB transaction %s", err)
+	}
+	if !r.Finished.IsZero() {
+		if _, err := tx.Exec("UPDATE RUNS SET FINISHED=? WHERE ID=?", dbTime(r.Finished), r.ID); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("updating RUNS failed %s", err)
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM RUN_COUNTS WHERE RUN=?", r.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("deleting from RUN_COUNTS failed %s", err)
+	}
+	for rrtype, count := range r.Counts {
+		if _, err := tx.Exec("INSERT INTO RUN_COUNTS(RUN,RRTYPE,SUCCESS,FAILURE) VALUES(?,?,?,?)", r.ID, rrtype, count.Success, count.Failure); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("writing to RUN_COUNTS failed %s", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Runs() ([]Run, error) {
+	rows, err := s.db.Query("SELECT ID,STARTED,FINISHED,RESOLVERS,INPUTHASH FROM RUNS ORDER BY ID")
+	if err != nil {
+		return nil, fmt.Errorf("could not query for runs %s", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	var index map[int64]int = make(map[int64]int, 0)
+	for rows.Next() {
+		var r Run
+		var finished sql.NullTime
+		var resolvers string
+		if err := rows.Scan(&r.ID, &r.Started, &finished, &resolvers, &r.InputHash); err != nil {
+			return nil, fmt.Errorf("error scanning runs %s", err)
+		}
+		r.Finished = finished.Time
+		if resolvers != "" {
+			r.Resolvers = strings.Split(resolvers, ",")
+		}
+		r.Counts = make(map[uint16]RunCount, 0)
+		index[r.ID] = len(runs)
+		runs = append(runs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	rows, err = s.db.Query("SELECT RUN,RRTYPE,SUCCESS,FAILURE FROM RUN_COUNTS")
+	if err != nil {
+		return nil, fmt.Errorf("could not query for run counts %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var run int64
+		var rrtype uint16
+		var count RunCount
+		if err := rows.Scan(&run, &rrtype, &count.Success, &count.Failure); err != nil {
+			return nil, fmt.Errorf("error scanning run counts %s", err)
+		}
+		if i, ok := index[run]; ok {
+			runs[i].Counts[rrtype] = count
+		}
+	}
+	return runs, rows.Err()
+}
+
+func (s *sqlStore) Checkpoints(run int64) ([]Checkpoint, error) {
+	rows, err := s.db.Query("SELECT RUN,TLD,OWNER,RRTYPE,SERVER,OUTCOME FROM CHECKPOINTS WHERE RUN=?", run)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for checkpoints %s", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []Checkpoint
+	for rows.Next() {
+		var c Checkpoint
+		var outcome string
+		if err := rows.Scan(&c.Run, &c.TLD, &c.Owner, &c.RRType, &c.Server, &outcome); err != nil {
+			return nil, fmt.Errorf("error scanning checkpoints %s", err)
+		}
+		c.Outcome = Outcome(outcome)
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,607 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// sqlStore implements Store for all SQL databases.
+// The backends only differ in the driver and a few statements.
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+
+	// statement to insert a row unless the primary key exists
+	insertIgnore string
+
+	// reports errors that might go away if the transaction is repeated
+	transient func(err error) bool
+}
+
+func (s *sqlStore) Dialect() string { return s.dialect }
+
+func (s *sqlStore) DB() *sql.DB { return s.db }
+
+func (s *sqlStore) Close() error { return s.db.Close() }
+
+func (s *sqlStore) Transient(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || s.transient(err)
+}
+
+// sqlTx saves observations with prepared statements
+type sqlTx struct {
+	tx             *sql.Tx
+	stmtRRData     *sql.Stmt
+	stmtRRSIG      *sql.Stmt
+	stmtCheckpoint *sql.Stmt
+	stmtAttempt    *sql.Stmt
+	stmtEDE        *sql.Stmt
+	stmtNSEC3      *sql.Stmt
+}
+
+func (s *sqlStore) Begin() (Tx, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("could not start DB transaction %w", err)
+	}
+
+	stmtRRData, err := tx.Prepare(s.insertIgnore + " INTO RRDATA(SHA256,RRDATA) VALUES(?,?)")
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into rrdata %w", err)
+	}
+
+	stmtRRSIG, err := tx.Prepare("INSERT INTO RRSIG(RESOLVED,TLD,OWNER,RRTYPE,SHA256,INCEPTION,EXPIRATION,SIG,KEYTAG,ALGORITHM,SIGNER,LABELS,ORIGTTL,TTL,SERVER,AUTHORITATIVE,TRANSPORT,PROOF,RUN) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		stmtRRData.Close()
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into rrsig %w", err)
+	}
+
+	// the outcome of a resumed query replaces the earlier one
+	stmtCheckpoint, err := tx.Prepare("REPLACE INTO CHECKPOINTS(RUN,TLD,OWNER,RRTYPE,SERVER,OUTCOME) VALUES(?,?,?,?,?,?)")
+	if err != nil {
+		stmtRRData.Close()
+		stmtRRSIG.Close()
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into checkpoints %w", err)
+	}
+
+	stmtAttempt, err := tx.Prepare("INSERT INTO QUERY_RESULT(RUN,TLD,OWNER,RRTYPE,SERVER,AUTHORITATIVE,TRANSPORT,ATTEMPT,SENT,LATENCY,RCODE,OUTCOME,EDE) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		stmtRRData.Close()
+		stmtRRSIG.Close()
+		stmtCheckpoint.Close()
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into query_result %w", err)
+	}
+
+	stmtEDE, err := tx.Prepare("INSERT INTO EXTENDED_ERROR(QUERY,CODE,TEXT) VALUES(?,?,?)")
+	if err != nil {
+		stmtRRData.Close()
+		stmtRRSIG.Close()
+		stmtCheckpoint.Close()
+		stmtAttempt.Close()
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into extended_error %w", err)
+	}
+
+	stmtNSEC3, err := tx.Prepare("INSERT INTO NSEC3(RESOLVED,TLD,SERVER,AUTHORITATIVE,RUN,HASH,OPTOUT,ITERATIONS,SALT) VALUES(?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		stmtRRData.Close()
+		stmtRRSIG.Close()
+		stmtCheckpoint.Close()
+		stmtAttempt.Close()
+		stmtEDE.Close()
+		tx.Rollback()
+		return nil, fmt.Errorf("could not prepare insert into nsec3 %w", err)
+	}
+
+	return &sqlTx{tx: tx, stmtRRData: stmtRRData, stmtRRSIG: stmtRRSIG, stmtCheckpoint: stmtCheckpoint, stmtAttempt: stmtAttempt, stmtEDE: stmtEDE, stmtNSEC3: stmtNSEC3}, nil
+}
+
+func (t *sqlTx) Insert(o Observation) error {
+	sha256 := rrdataKey(o.RRData)
+
+	if _, err := t.stmtRRData.Exec(sha256, o.RRData); err != nil {
+		return fmt.Errorf("writing to RRDATA failed %w", err)
+	}
+
+	resolved := o.Resolved
+	if resolved.IsZero() {
+		resolved = time.Now()
+	}
+	run := sql.NullInt64{Int64: o.Run, Valid: o.Run != 0}
+	for _, sig := range o.Signatures {
+		inception := time.Unix(int64(sig.Inception), 0)
+		expiration := time.Unix(int64(sig.Expiration), 0)
+		if _, err := t.stmtRRSIG.Exec(dbTime(resolved), o.TLD, o.Owner, o.RRType, sha256, dbTime(inception), dbTime(expiration), sig.Signature, sig.KeyTag, sig.Algorithm, sig.SignerName, sig.Labels, sig.OrigTtl, o.TTL, o.Server, o.Authoritative, o.Transport, o.Proof, run); err != nil {
+			return fmt.Errorf("writing to RRSIG failed %w", err)
+		}
+	}
+	if o.RRType == dns.TypeNSEC3 {
+		if err := t.insertNSEC3(o, resolved, run); err != nil {
+			return err
+		}
+	}
+	if o.Run != 0 {
+		return t.Checkpoint(o.Checkpoint())
+	}
+	return nil
+}
+
+func (t *sqlTx) Checkpoint(c Checkpoint) error {
+	if _, err := t.stmtCheckpoint.Exec(c.Run, c.TLD, c.Owner, c.RRType, c.Server, string(c.Outcome)); err != nil {
+		return fmt.Errorf("writing to CHECKPOINTS failed %w", err)
+	}
+	return nil
+}
+
+func (t *sqlTx) Attempt(a Attempt) error {
+	run := sql.NullInt64{Int64: a.Run, Valid: a.Run != 0}
+	rcode := sql.NullInt64{Int64: int64(a.Rcode), Valid: a.Rcode >= 0}
+	ede := sql.NullInt64{Int64: int64(a.EDE), Valid: a.EDE >= 0}
+	res, err := t.stmtAttempt.Exec(run, a.TLD, a.Owner, a.RRType, a.Server, a.Authoritative, a.Transport, a.Attempt, dbTime(a.Sent), a.Latency.Milliseconds(), rcode, string(a.Outcome), ede)
+	if err != nil {
+		return fmt.Errorf("writing to QUERY_RESULT failed %w", err)
+	}
+	if len(a.ExtendedErrors) == 0 {
+		return nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("could not get query result ID %w", err)
+	}
+	for _, e := range a.ExtendedErrors {
+		if _, err := t.stmtEDE.Exec(id, e.Code, e.Text); err != nil {
+			return fmt.Errorf("writing to EXTENDED_ERROR failed %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *sqlTx) Commit() error {
+	t.close()
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	t.close()
+	return t.tx.Rollback()
+}
+
+// close closes all prepared statements
+func (t *sqlTx) close() {
+	t.stmtRRData.Close()
+	t.stmtRRSIG.Close()
+	t.stmtCheckpoint.Close()
+	t.stmtAttempt.Close()
+	t.stmtEDE.Close()
+	t.stmtNSEC3.Close()
+}
+
+// insertNSEC3 saves the parameters of the first NSEC3 record of an observation,
+// all NSEC3 records of a zone have the same parameters
+func (t *sqlTx) insertNSEC3(o Observation, resolved time.Time, run sql.NullInt64) error {
+	for _, line := range strings.Split(o.RRData, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return fmt.Errorf("could not parse >%s< %s", line, err)
+		}
+		nsec3, ok := rr.(*dns.NSEC3)
+		if !ok {
+			continue
+		}
+		salt := nsec3.Salt
+		if salt == "-" {
+			salt = ""
+		}
+		if _, err := t.stmtNSEC3.Exec(dbTime(resolved), o.TLD, o.Server, o.Authoritative, run, nsec3.Hash, nsec3.Flags&1 == 1, nsec3.Iterations, salt); err != nil {
+			return fmt.Errorf("writing to NSEC3 failed %w", err)
+		}
+		return nil
+	}
+	return nil
+}
+
+func (s *sqlStore) SOAs(f Filter) ([]SOA, error) {
+	where, args := f.where("RRSIG.")
+	where = append(where, "RRSIG.RRTYPE=?", "RRSIG.OWNER=''", "RRSIG.PROOF=0")
+	args = append(args, dns.TypeSOA)
+
+	rows, err := s.db.Query("SELECT RESOLVED,TLD,RRDATA,SERVER,RUN FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE "+strings.Join(where, " AND ")+" ORDER BY RESOLVED,TLD", args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for SOA data %s", err)
+	}
+	defer rows.Close() // Prepared statements take up server resources and should be closed after use.
+
+	var soas []SOA
+	for rows.Next() {
+		var soa SOA
+		var rrdata string
+		var server sql.NullString
+		var run sql.NullInt64
+		if err := rows.Scan(&soa.Resolved, &soa.TLD, &rrdata, &server, &run); err != nil {
+			return nil, fmt.Errorf("error scanning SOA data %s", err)
+		}
+		soa.Server = server.String
+		soa.Run = run.Int64
+		rr, err := dns.NewRR(rrdata)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse SOA record >%s< %s", rrdata, err)
+		}
+		var ok bool
+		if soa.Record, ok = rr.(*dns.SOA); !ok {
+			return nil, fmt.Errorf("not a SOA record >%s<", rrdata)
+		}
+		soas = append(soas, soa)
+	}
+	return soas, rows.Err()
+}
+
+func (s *sqlStore) Signatures(f Filter) ([]Signature, error) {
+	where, args := f.where("")
+	where = append(where, f.owners("")...)
+	query := "SELECT " + signatureColumns + " FROM RRSIG"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY RESOLVED,TLD"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for RRSIG data %s", err)
+	}
+	defer rows.Close() // Prepared statements take up server resources and should be closed after use.
+
+	var sigs []Signature
+	for rows.Next() {
+		sig, err := scanSignature(rows)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, rows.Err()
+}
+
+func (s *sqlStore) RRSets(f Filter) ([]RRSet, error) {
+	where, args := f.where("RRSIG.")
+	where = append(where, f.owners("RRSIG.")...)
+	query := "SELECT RRSIG.SHA256,RRDATA," + signatureColumns + " FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256)"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY RESOLVED,TLD,OWNER,RRTYPE,SERVER,PROOF,RRSIG.SHA256"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for RR sets %s", err)
+	}
+	defer rows.Close() // Prepared statements take up server resources and should be closed after use.
+
+	var rrsets []RRSet
+	var lastSHA256 string
+	for rows.Next() {
+		var sha256, rrdata string
+		sig, err := scanSignature(rows, &sha256, &rrdata)
+		if err != nil {
+			return nil, err
+		}
+
+		// all signatures of one observed RR set are consecutive rows
+		n := len(rrsets)
+		if n > 0 && lastSHA256 == sha256 && rrsets[n-1].Resolved.Equal(sig.Resolved) && rrsets[n-1].TLD == sig.TLD && rrsets[n-1].Owner == sig.Owner && rrsets[n-1].RRType == sig.RRType && rrsets[n-1].Server == sig.Server && rrsets[n-1].Proof == sig.Proof {
+			rrsets[n-1].Signatures = append(rrsets[n-1].Signatures, sig)
+			continue
+		}
+		rrsets = append(rrsets, RRSet{Resolved: sig.Resolved, TLD: sig.TLD, Owner: sig.Owner, RRType: sig.RRType, RRData: rrdata, Server: sig.Server, Authoritative: sig.Authoritative, Transport: sig.Transport, Proof: sig.Proof, Run: sig.Run, Signatures: []Signature{sig}})
+		lastSHA256 = sha256
+	}
+	return rrsets, rows.Err()
+}
+
+func (s *sqlStore) NSEC3Params(f Filter) ([]NSEC3Param, error) {
+	// the NSEC3 table has no RRTYPE column, the parameters hold for all RR types
+	f.RRType, f.RRTypes = 0, nil
+	where, args := f.where("")
+	query := "SELECT RESOLVED,TLD,SERVER,AUTHORITATIVE,RUN,HASH,OPTOUT,ITERATIONS,SALT FROM NSEC3"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY RESOLVED,TLD"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for NSEC3 parameters %s", err)
+	}
+	defer rows.Close()
+
+	var params []NSEC3Param
+	for rows.Next() {
+		var p NSEC3Param
+		var run sql.NullInt64
+		if err := rows.Scan(&p.Resolved, &p.TLD, &p.Server, &p.Authoritative, &run, &p.Hash, &p.OptOut, &p.Iterations, &p.Salt); err != nil {
+			return nil, fmt.Errorf("error scanning NSEC3 parameters %s", err)
+		}
+		p.Run = run.Int64
+		params = append(params, p)
+	}
+	return params, rows.Err()
+}
+
+func (s *sqlStore) Attempts(f Filter) ([]Attempt, error) {
+	where, args := f.where("")
+	query := "SELECT ID,RUN,TLD,OWNER,RRTYPE,SERVER,AUTHORITATIVE,TRANSPORT,ATTEMPT,SENT,LATENCY,RCODE,OUTCOME,EDE FROM QUERY_RESULT"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY SENT,ID"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for query results %s", err)
+	}
+	defer rows.Close()
+
+	var attempts []Attempt
+	for rows.Next() {
+		var a Attempt
+		var run, rcode, ede sql.NullInt64
+		var latency int64
+		var outcome string
+		if err := rows.Scan(&a.ID, &run, &a.TLD, &a.Owner, &a.RRType, &a.Server, &a.Authoritative, &a.Transport, &a.Attempt, &a.Sent, &latency, &rcode, &outcome, &ede); err != nil {
+			return nil, fmt.Errorf("error scanning query results %s", err)
+		}
+		a.Run = run.Int64
+		a.Latency = time.Duration(latency) * time.Millisecond
+		a.Rcode = -1
+		if rcode.Valid {
+			a.Rcode = int(rcode.Int64)
+		}
+		a.Outcome = Outcome(outcome)
+		a.EDE = -1
+		if ede.Valid {
+			a.EDE = int(ede.Int64)
+		}
+		attempts = append(attempts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// extended errors of all attempts with at least one
+	var index map[int64]int = make(map[int64]int, 0)
+	for i := range attempts {
+		if attempts[i].EDE >= 0 {
+			index[attempts[i].ID] = i
+		}
+	}
+	if len(index) == 0 {
+		return attempts, nil
+	}
+	query = "SELECT QUERY,CODE,TEXT FROM EXTENDED_ERROR WHERE QUERY IN (SELECT ID FROM QUERY_RESULT"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += ") ORDER BY ID"
+	rows, err = s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("could not query for extended errors %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var e ExtendedError
+		if err := rows.Scan(&id, &e.Code, &e.Text); err != nil {
+			return nil, fmt.Errorf("error scanning extended errors %s", err)
+		}
+		if i, ok := index[id]; ok {
+			attempts[i].ExtendedErrors = append(attempts[i].ExtendedErrors, e)
+		}
+	}
+	return attempts, rows.Err()
+}
+
+// signatureColumns are the columns read by scanSignature
+const signatureColumns = "RESOLVED,TLD,OWNER,RRTYPE,INCEPTION,EXPIRATION,KEYTAG,ALGORITHM,SIGNER,LABELS,ORIGTTL,SIG,TTL,SERVER,AUTHORITATIVE,TRANSPORT,PROOF,RUN"
+
+// scanSignature reads signatureColumns after the leading columns given in dest
+func scanSignature(rows *sql.Rows, dest ...interface{}) (Signature, error) {
+	var sig Signature
+	var keytag, algorithm, labels, origttl, ttl, run sql.NullInt64
+	var signer, server sql.NullString
+	dest = append(dest, &sig.Resolved, &sig.TLD, &sig.Owner, &sig.RRType, &sig.Inception, &sig.Expiration, &keytag, &algorithm, &signer, &labels, &origttl, &sig.Signature, &ttl, &server, &sig.Authoritative, &sig.Transport, &sig.Proof, &run)
+	if err := rows.Scan(dest...); err != nil {
+		return sig, fmt.Errorf("error scanning RRSIG data %s", err)
+	}
+	sig.KeyTag = uint16(keytag.Int64)
+	sig.Algorithm = uint8(algorithm.Int64)
+	sig.SignerName = signer.String
+	sig.Labels = uint8(labels.Int64)
+	sig.OrigTTL = uint32(origttl.Int64)
+	sig.TTL = uint32(ttl.Int64)
+	sig.Server = server.String
+	sig.Run = run.Int64
+	return sig, nil
+}
+
+func (s *sqlStore) Rekey(batch int) (RekeyResult, error) {
+	var result RekeyResult
+
+	type row struct {
+		id      int64
+		rrdata  string
+		origttl sql.NullInt64
+	}
+
+	var lastID int64
+	for {
+		// read one batch, rows are changed after the result set is closed
+		rows, err := s.db.Query("SELECT RRSIG.ID,RRDATA,ORIGTTL FROM RRSIG JOIN RRDATA ON(RRSIG.SHA256=RRDATA.SHA256) WHERE RRSIG.TTL IS NULL AND RRSIG.ID>? ORDER BY RRSIG.ID LIMIT ?", lastID, batch)
+		if err != nil {
+			return result, fmt.Errorf("could not query for RRSIG without TTL %s", err)
+		}
+		var todo []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.rrdata, &r.origttl); err != nil {
+				rows.Close()
+				return result, fmt.Errorf("error scanning RRSIG data %s", err)
+			}
+			todo = append(todo, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return result, err
+		}
+		if len(todo) == 0 {
+			break
+		}
+		lastID = todo[len(todo)-1].id
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return result, fmt.Errorf("could not start DB transaction %s", err)
+		}
+		for _, r := range todo {
+			rrs, err := RRSet{RRData: r.rrdata}.RRs()
+			if err != nil || len(rrs) == 0 {
+				tx.Rollback()
+				return result, fmt.Errorf("RRSIG %d: could not parse RRDATA %s", r.id, err)
+			}
+			ttl := rrs[0].Header().Ttl
+
+			// without original TTL the RR set can not be normalized
+			if !r.origttl.Valid {
+				if _, err := tx.Exec("UPDATE RRSIG SET TTL=? WHERE ID=?", ttl, r.id); err != nil {
+					tx.Rollback()
+					return result, fmt.Errorf("updating RRSIG failed %s", err)
+				}
+				result.NoOrigTTL++
+				continue
+			}
+
+			rrdata := NormalizeRRSet(rrs, uint32(r.origttl.Int64))
+			sha256 := rrdataKey(rrdata)
+			if _, err := tx.Exec(s.insertIgnore+" INTO RRDATA(SHA256,RRDATA) VALUES(?,?)", sha256, rrdata); err != nil {
+				tx.Rollback()
+				return result, fmt.Errorf("writing to RRDATA failed %s", err)
+			}
+			if _, err := tx.Exec("UPDATE RRSIG SET SHA256=?,TTL=? WHERE ID=?", sha256, ttl, r.id); err != nil {
+				tx.Rollback()
+				return result, fmt.Errorf("updating RRSIG failed %s", err)
+			}
+			result.Rekeyed++
+		}
+		if err := tx.Commit(); err != nil {
+			return result, fmt.Errorf("could not commit to DB %s", err)
+		}
+	}
+
+	res, err := s.db.Exec("DELETE FROM RRDATA WHERE SHA256 NOT IN (SELECT SHA256 FROM RRSIG)")
+	if err != nil {
+		return result, fmt.Errorf("could not delete unused RRDATA %s", err)
+	}
+	deleted, _ := res.RowsAffected()
+	result.Deleted = int(deleted)
+	return result, nil
+}
+
+// rrdataKey returns the primary key of RRDATA
+func rrdataKey(rrdata string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(rrdata)))
+}
+
+// where returns the conditions and arguments for the filter
+func (f Filter) where(prefix string) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.TLD != "" {
+		where = append(where, prefix+"TLD=?")
+		args = append(args, f.TLD)
+	}
+	if f.RRType != 0 {
+		where = append(where, prefix+"RRTYPE=?")
+		args = append(args, f.RRType)
+	}
+	if len(f.RRTypes) > 0 {
+		where = append(where, prefix+"RRTYPE IN ("+strings.TrimSuffix(strings.Repeat("?,", len(f.RRTypes)), ",")+")")
+		for _, rrtype := range f.RRTypes {
+			args = append(args, rrtype)
+		}
+	}
+	if f.Server != "" {
+		where = append(where, prefix+"SERVER=?")
+		args = append(args, f.Server)
+	}
+	if len(f.Runs) > 0 {
+		var runs []string
+		var noRun bool
+		for _, run := range f.Runs {
+			if run == NoRun {
+				noRun = true
+				continue
+			}
+			runs = append(runs, "?")
+			args = append(args, run)
+		}
+		switch {
+		case noRun && len(runs) > 0:
+			where = append(where, "("+prefix+"RUN IN ("+strings.Join(runs, ",")+") OR "+prefix+"RUN IS NULL)")
+		case noRun:
+			where = append(where, prefix+"RUN IS NULL")
+		default:
+			where = append(where, prefix+"RUN IN ("+strings.Join(runs, ",")+")")
+		}
+	}
+	switch f.Source {
+	case Recursive:
+		where = append(where, prefix+"AUTHORITATIVE=0")
+	case Authoritative:
+		where = append(where, prefix+"AUTHORITATIVE=1")
+	}
+	return where, args
+}
+
+// owners returns the condition on the owner name of signatures and RR sets.
+// Denial proofs are owned by whatever name covers the queried name, they always match.
+func (f Filter) owners(prefix string) []string {
+	if f.AllOwners {
+		return nil
+	}
+	return []string{"(" + prefix + "OWNER='' OR " + prefix + "PROOF=1)"}
+}
+
+// dbTime converts a time to the representation stored in the database.
+// All times are stored in UTC with a precision of one second.
+func dbTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
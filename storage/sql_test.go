@@ -0,0 +1,595 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/ulrichwisser/dnssectiming/schema"
+)
+
+// openTestStore returns an in-memory SQLite database with all migrations applied
+func openTestStore(t *testing.T) *sqlStore {
+	t.Helper()
+	s, err := openSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every connection would get its own in-memory database
+	s.db.SetMaxOpenConns(1)
+	t.Cleanup(func() { s.Close() })
+
+	if _, err := schema.Migrate(s.db, s.Dialect()); err != nil {
+		t.Fatal(err)
+	}
+	if err := schema.Check(s.db, s.Dialect()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// testObservation returns the signed SOA set of se. with two signatures
+func testObservation(t *testing.T, resolved time.Time) Observation {
+	t.Helper()
+	soa, err := dns.NewRR("se. 3600 IN SOA ns1.se. hostmaster.se. 2024010101 1800 900 1209600 3600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sigs []*dns.RRSIG
+	for _, keytag := range []uint16{12345, 54321} {
+		sigs = append(sigs, &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: "se.", Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+			TypeCovered: dns.TypeSOA,
+			Algorithm:   dns.ECDSAP256SHA256,
+			Labels:      1,
+			OrigTtl:     3600,
+			Expiration:  uint32(resolved.Add(10 * 24 * time.Hour).Unix()),
+			Inception:   uint32(resolved.Add(-time.Hour).Unix()),
+			KeyTag:      keytag,
+			SignerName:  "se.",
+			Signature:   "c2lnbmF0dXJl",
+		})
+	}
+	return Observation{
+		Resolved:      resolved,
+		TLD:           "se.",
+		RRType:        dns.TypeSOA,
+		RRData:        NormalizeRRSet([]dns.RR{soa}, 3600),
+		TTL:           1800,
+		Signatures:    sigs,
+		Server:        "192.0.2.1:53",
+		Authoritative: true,
+		Transport:     "tcp",
+	}
+}
+
+// insert saves observations in one transaction
+func insert(t *testing.T, s Store, observations ...Observation) {
+	t.Helper()
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range observations {
+		if err := tx.Insert(o); err != nil {
+			tx.Rollback()
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrationsOfAllDialects(t *testing.T) {
+	sqlite, err := schema.Migrations(schema.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mysql, err := schema.Migrations(schema.MySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqlite) != len(mysql) {
+		t.Fatalf("%d SQLite migrations, %d MySQL migrations", len(sqlite), len(mysql))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != mysql[i].Version || sqlite[i].Name != mysql[i].Name {
+			t.Errorf("migration %04d_%s of SQLite is %04d_%s in MySQL", sqlite[i].Version, sqlite[i].Name, mysql[i].Version, mysql[i].Name)
+		}
+		if len(mysql[i].Statements) == 0 {
+			t.Errorf("MySQL migration %04d_%s has no statements", mysql[i].Version, mysql[i].Name)
+		}
+	}
+
+	// a migrated database has nothing left to apply
+	s := openTestStore(t)
+	applied, err := schema.Migrate(s.db, s.Dialect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("migrated database applied %d migrations again", len(applied))
+	}
+}
+
+func TestProofMigration(t *testing.T) {
+	s, err := openSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.db.SetMaxOpenConns(1)
+	defer s.Close()
+
+	migrations, err := schema.Migrations(s.Dialect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrate := func(m schema.Migration) {
+		for _, stmt := range m.Statements {
+			if _, err := s.db.Exec(stmt); err != nil {
+				t.Fatalf("%04d_%s: %s", m.Version, m.Name, err)
+			}
+		}
+	}
+
+	// signatures saved before denial proofs were marked
+	var proof schema.Migration
+	for _, m := range migrations {
+		if m.Name == "proof" {
+			proof = m
+			break
+		}
+		migrate(m)
+	}
+	rows := []struct {
+		owner  string
+		rrtype uint16
+		proof  bool
+	}{
+		{"", dns.TypeSOA, false},
+		{"", dns.TypeNSEC3PARAM, false},
+		{"", dns.TypeNSEC, false},
+		{"nic.se.", dns.TypeNSEC3, false},
+		{"<random>.se.", dns.TypeNSEC3, true},
+		{"<random>.se.", dns.TypeSOA, true},
+	}
+	for _, row := range rows {
+		if _, err := s.db.Exec("INSERT INTO RRSIG(TLD,OWNER,RRTYPE,SHA256,INCEPTION,EXPIRATION,SIG) VALUES('se.',?,?,'',CURRENT_TIMESTAMP,CURRENT_TIMESTAMP,'')", row.owner, row.rrtype); err != nil {
+			t.Fatal(err)
+		}
+	}
+	migrate(proof)
+
+	for _, row := range rows {
+		var got bool
+		if err := s.db.QueryRow("SELECT PROOF FROM RRSIG WHERE OWNER=? AND RRTYPE=?", row.owner, row.rrtype).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != row.proof {
+			t.Errorf("%q %s: proof %v, want %v", row.owner, dns.TypeToString[row.rrtype], got, row.proof)
+		}
+	}
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	s := openTestStore(t)
+	resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	o := testObservation(t, resolved)
+	insert(t, s, o)
+
+	sigs, err := s.Signatures(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 {
+		t.Fatalf("got %d signatures, want 2", len(sigs))
+	}
+	for i, sig := range sigs {
+		rrsig := o.Signatures[i]
+		if !sig.Resolved.Equal(resolved) || sig.TLD != "se." || sig.Owner != "" || sig.RRType != dns.TypeSOA {
+			t.Errorf("signature %d is %v %s %q %d", i, sig.Resolved, sig.TLD, sig.Owner, sig.RRType)
+		}
+		if sig.Inception.Unix() != int64(rrsig.Inception) || sig.Expiration.Unix() != int64(rrsig.Expiration) {
+			t.Errorf("signature %d valid %v to %v", i, sig.Inception, sig.Expiration)
+		}
+		if sig.KeyTag != rrsig.KeyTag || sig.Algorithm != rrsig.Algorithm || sig.SignerName != rrsig.SignerName || sig.Labels != rrsig.Labels || sig.OrigTTL != rrsig.OrigTtl || sig.Signature != rrsig.Signature {
+			t.Errorf("signature %d is %+v", i, sig)
+		}
+		if sig.TTL != o.TTL || sig.Server != o.Server || !sig.Authoritative || sig.Transport != o.Transport || sig.Proof || sig.Run != 0 {
+			t.Errorf("signature %d observed %+v", i, sig)
+		}
+		if sig.Lifetime() != 10*24*3600 {
+			t.Errorf("signature %d lifetime is %d", i, sig.Lifetime())
+		}
+	}
+
+	// the SOA record itself
+	soas, err := s.SOAs(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(soas) != 2 || soas[0].Record.Serial != 2024010101 {
+		t.Fatalf("got SOA %+v", soas)
+	}
+}
+
+func TestRRSetRoundTrip(t *testing.T) {
+	s := openTestStore(t)
+	resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	o := testObservation(t, resolved)
+	later := testObservation(t, resolved.Add(time.Hour))
+	later.Signatures = later.Signatures[:1]
+	insert(t, s, o, later)
+
+	rrsets, err := s.RRSets(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrsets) != 2 {
+		t.Fatalf("got %d RR sets, want 2", len(rrsets))
+	}
+	for i, rrset := range rrsets {
+		if rrset.RRData != o.RRData || rrset.TLD != "se." || rrset.RRType != dns.TypeSOA {
+			t.Errorf("RR set %d is %+v", i, rrset)
+		}
+		rrs, err := rrset.RRs()
+		if err != nil || len(rrs) != 1 {
+			t.Errorf("RR set %d has records %v %v", i, rrs, err)
+		}
+	}
+	if len(rrsets[0].Signatures) != 2 || len(rrsets[1].Signatures) != 1 {
+		t.Errorf("RR sets have %d and %d signatures, want 2 and 1", len(rrsets[0].Signatures), len(rrsets[1].Signatures))
+	}
+
+	// the same RR set from another server is another observation
+	other := testObservation(t, resolved)
+	other.Server = "192.0.2.2:53"
+	insert(t, s, other)
+	rrsets, err = s.RRSets(Filter{Server: other.Server})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrsets) != 1 || len(rrsets[0].Signatures) != 2 || rrsets[0].Server != other.Server || !rrsets[0].Authoritative {
+		t.Errorf("got RR sets %+v of %s", rrsets, other.Server)
+	}
+
+	// the signature is rebuilt as it was received
+	if got := rrsets[0].Signatures[0].RRSIG("se."); got.String() != o.Signatures[0].String() {
+		t.Errorf("got RRSIG %s, want %s", got, o.Signatures[0])
+	}
+}
+
+func TestProofRRSets(t *testing.T) {
+	s := openTestStore(t)
+	resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	o := testObservation(t, resolved)
+
+	// the same SOA as denial proof of nic.se. AAAA
+	proof := testObservation(t, resolved)
+	proof.Signatures = proof.Signatures[:1]
+	proof.QueryType = dns.TypeAAAA
+	proof.Outcome = OutcomeNoData
+	proof.Proof = true
+	proof.QueryOwner = "nic.se."
+	insert(t, s, o, proof)
+
+	rrsets, err := s.RRSets(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sets, proofs int
+	for _, rrset := range rrsets {
+		if rrset.Proof {
+			proofs++
+			if len(rrset.Signatures) != 1 {
+				t.Errorf("proof has %d signatures, want 1", len(rrset.Signatures))
+			}
+			continue
+		}
+		sets++
+		if len(rrset.Signatures) != 2 {
+			t.Errorf("RR set has %d signatures, want 2", len(rrset.Signatures))
+		}
+	}
+	if sets != 1 || proofs != 1 {
+		t.Errorf("got %d RR sets and %d proofs, want one of each", sets, proofs)
+	}
+
+	// proofs are not the SOA record of the TLD
+	soas, err := s.SOAs(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(soas) != 2 {
+		t.Errorf("got %d SOA records, want 2", len(soas))
+	}
+}
+
+func TestRunRoundTrip(t *testing.T) {
+	s := openTestStore(t)
+	started := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	id, err := s.StartRun(Run{Started: started, Resolvers: []string{"192.0.2.1", "192.0.2.2"}, InputHash: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := s.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != id || !runs[0].Partial() {
+		t.Fatalf("got runs %+v", runs)
+	}
+
+	o := testObservation(t, started)
+	o.Run = id
+	insert(t, s, o)
+
+	finished := started.Add(time.Minute)
+	counts := map[uint16]RunCount{dns.TypeSOA: {Success: 1, Failure: 0}, dns.TypeDNSKEY: {Success: 0, Failure: 1}}
+	if err := s.FinishRun(Run{ID: id, Finished: finished, Counts: counts}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err = s.Runs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Run{ID: id, Started: started, Finished: finished, Resolvers: []string{"192.0.2.1", "192.0.2.2"}, InputHash: "abc", Counts: counts}
+	if len(runs) != 1 {
+		t.Fatalf("got %d runs, want 1", len(runs))
+	}
+	got := runs[0]
+	if got.ID != want.ID || !got.Started.Equal(want.Started) || !got.Finished.Equal(want.Finished) || !reflect.DeepEqual(got.Resolvers, want.Resolvers) || got.InputHash != want.InputHash || !reflect.DeepEqual(got.Counts, want.Counts) {
+		t.Errorf("got run %+v, want %+v", got, want)
+	}
+
+	// observations remember their run
+	sigs, err := s.Signatures(Filter{Runs: []int64{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 2 || sigs[0].Run != id {
+		t.Fatalf("got signatures %+v of run %d", sigs, id)
+	}
+
+	// the SOA record and the signatures were seen in the same probe
+	soas, err := s.SOAs(Filter{Runs: []int64{id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(soas) == 0 || soas[0].Probe() != sigs[0].Probe() {
+		t.Errorf("SOA %+v and signature %+v are not in one probe", soas, sigs[0])
+	}
+
+	// observations of a run save their checkpoint
+	checkpoints, err := s.Checkpoints(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCheckpoint := Checkpoint{Run: id, TLD: "se.", RRType: dns.TypeSOA, Server: o.Server, Outcome: OutcomeOK}
+	if len(checkpoints) != 1 || checkpoints[0] != wantCheckpoint {
+		t.Errorf("got checkpoints %+v, want %+v", checkpoints, wantCheckpoint)
+	}
+}
+
+func TestFilterRuns(t *testing.T) {
+	s := openTestStore(t)
+	started := time.Date(2026, 1, 2, 6, 0, 0, 0, time.UTC)
+	id, err := s.StartRun(Run{Started: started})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := testObservation(t, started.Add(-24*time.Hour))
+	current := testObservation(t, started)
+	current.Run = id
+	insert(t, s, old, current)
+
+	tests := []struct {
+		runs []int64
+		want int
+	}{
+		{nil, 4},
+		{[]int64{id}, 2},
+		{[]int64{id + 1}, 0},
+		{[]int64{NoRun}, 2},
+		{[]int64{id, NoRun}, 4},
+	}
+	for _, test := range tests {
+		sigs, err := s.Signatures(Filter{Runs: test.runs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sigs) != test.want {
+			t.Errorf("runs %v: got %d signatures, want %d", test.runs, len(sigs), test.want)
+		}
+	}
+}
+
+func TestNSEC3ParamsFilter(t *testing.T) {
+	s := openTestStore(t)
+	resolved := time.Date(2026, 1, 2, 6, 0, 0, 0, time.UTC)
+	nsec3, err := dns.NewRR("0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.se. 3600 IN NSEC3 1 1 0 - 0P9MHAVEQVM6T7VBL5LOP2U3T2RP3TOM A RRSIG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := testObservation(t, resolved)
+	o.RRType = dns.TypeNSEC3
+	o.RRData = NormalizeRRSet([]dns.RR{nsec3}, 3600)
+	insert(t, s, o)
+
+	tests := []Filter{
+		{TLD: "se."},
+		{TLD: "se.", RRType: dns.TypeSOA},
+		{TLD: "se.", RRTypes: []uint16{dns.TypeSOA, dns.TypeDNSKEY}, Source: Authoritative, Runs: []int64{NoRun}},
+	}
+	for _, f := range tests {
+		params, err := s.NSEC3Params(f)
+		if err != nil {
+			t.Fatalf("%+v: %s", f, err)
+		}
+		if len(params) != 1 || params[0].Iterations != 0 || !params[0].OptOut {
+			t.Errorf("%+v: got %+v, want one opt-out parameter set without iterations", f, params)
+		}
+	}
+}
+
+func TestFilterWhere(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		where  []string
+		args   []interface{}
+	}{
+		{"empty", Filter{}, nil, nil},
+		{"tld", Filter{TLD: "se."}, []string{"R.TLD=?"}, []interface{}{"se."}},
+		{"type", Filter{RRType: dns.TypeSOA}, []string{"R.RRTYPE=?"}, []interface{}{dns.TypeSOA}},
+		{"types", Filter{RRTypes: []uint16{dns.TypeSOA, dns.TypeDNSKEY}}, []string{"R.RRTYPE IN (?,?)"}, []interface{}{dns.TypeSOA, dns.TypeDNSKEY}},
+		{"server", Filter{Server: "192.0.2.1:53"}, []string{"R.SERVER=?"}, []interface{}{"192.0.2.1:53"}},
+		{"runs", Filter{Runs: []int64{1, 2}}, []string{"R.RUN IN (?,?)"}, []interface{}{int64(1), int64(2)}},
+		{"no run", Filter{Runs: []int64{NoRun}}, []string{"R.RUN IS NULL"}, nil},
+		{"runs and no run", Filter{Runs: []int64{1, NoRun}}, []string{"(R.RUN IN (?) OR R.RUN IS NULL)"}, []interface{}{int64(1)}},
+		{"recursive", Filter{Source: Recursive}, []string{"R.AUTHORITATIVE=0"}, nil},
+		{"authoritative", Filter{Source: Authoritative}, []string{"R.AUTHORITATIVE=1"}, nil},
+		{"all", Filter{TLD: "se.", RRType: dns.TypeSOA, Runs: []int64{3}, Source: Authoritative}, []string{"R.TLD=?", "R.RRTYPE=?", "R.RUN IN (?)", "R.AUTHORITATIVE=1"}, []interface{}{"se.", dns.TypeSOA, int64(3)}},
+	}
+	for _, test := range tests {
+		where, args := test.filter.where("R.")
+		if !reflect.DeepEqual(where, test.where) || !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: got %q %v, want %q %v", test.name, where, args, test.where, test.args)
+		}
+	}
+}
+
+// errFlaky is the error of flakyStore
+var errFlaky = errors.New("database is locked")
+
+// flakyStore fails to start the first transactions
+type flakyStore struct {
+	Store
+	failures  int   // number of failing transactions
+	err       error // error of the failing transactions
+	transient bool  // err is transient
+	begins    int
+}
+
+func (f *flakyStore) Begin() (Tx, error) {
+	f.begins++
+	if f.begins <= f.failures {
+		return nil, f.err
+	}
+	return f.Store.Begin()
+}
+
+func (f *flakyStore) Transient(err error) bool {
+	return f.transient && errors.Is(err, errFlaky)
+}
+
+func TestWriterFlushRetry(t *testing.T) {
+	backoff := writeBackoff
+	writeBackoff = time.Millisecond
+	defer func() { writeBackoff = backoff }()
+
+	tests := []struct {
+		name      string
+		failures  int
+		transient bool
+		begins    int
+		ok        bool
+	}{
+		{"no failure", 0, true, 1, true},
+		{"transient", 2, true, 3, true},
+		{"permanent", 1, false, 1, false},
+		{"too many retries", writeRetries + 1, true, writeRetries + 1, false},
+	}
+	for _, test := range tests {
+		store := &flakyStore{Store: openTestStore(t), failures: test.failures, err: errFlaky, transient: test.transient}
+		w := NewWriter(store, 10)
+		resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+		if err := w.Write(testObservation(t, resolved)); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if w.Buffered() != 1 {
+			t.Fatalf("%s: %d rows buffered, want 1", test.name, w.Buffered())
+		}
+
+		err := w.Flush()
+		if store.begins != test.begins {
+			t.Errorf("%s: %d transactions, want %d", test.name, store.begins, test.begins)
+		}
+		sigs, serr := store.Signatures(Filter{})
+		if serr != nil {
+			t.Fatal(serr)
+		}
+		if test.ok {
+			if err != nil || w.Buffered() != 0 || len(sigs) != 2 {
+				t.Errorf("%s: got %v, %d rows buffered, %d signatures saved", test.name, err, w.Buffered(), len(sigs))
+			}
+			continue
+		}
+		if !errors.Is(err, errFlaky) || w.Buffered() != 1 || len(sigs) != 0 {
+			t.Errorf("%s: got %v, %d rows buffered, %d signatures saved", test.name, err, w.Buffered(), len(sigs))
+		}
+	}
+}
+
+func TestFilterOwners(t *testing.T) {
+	s := openTestStore(t)
+	resolved := time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC)
+	apex := testObservation(t, resolved)
+	nic := testObservation(t, resolved)
+	nic.Owner = "nic.se."
+	proof := testObservation(t, resolved)
+	proof.Owner = "a.se."
+	proof.Proof = true
+	insert(t, s, apex, nic, proof)
+
+	tests := []struct {
+		filter Filter
+		want   int
+	}{
+		{Filter{}, 4},
+		{Filter{AllOwners: true}, 6},
+	}
+	for _, test := range tests {
+		sigs, err := s.Signatures(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sigs) != test.want {
+			t.Errorf("all owners %v: got %d signatures, want %d", test.filter.AllOwners, len(sigs), test.want)
+		}
+		for _, sig := range sigs {
+			if sig.Owner == "nic.se." && !test.filter.AllOwners {
+				t.Errorf("signature of nic.se. without all owners")
+			}
+		}
+		rrsets, err := s.RRSets(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rrsets) != test.want/2 {
+			t.Errorf("all owners %v: got %d RR sets, want %d", test.filter.AllOwners, len(rrsets), test.want/2)
+		}
+	}
+}
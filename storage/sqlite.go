@@ -0,0 +1,54 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/ulrichwisser/dnssectiming/schema"
+)
+
+// openSQLite opens (and creates if needed) the SQLite database file at path
+func openSQLite(path string) (*sqlStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no SQLite database file given")
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=10000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	return &sqlStore{
+		db:           db,
+		dialect:      schema.SQLite,
+		insertIgnore: "INSERT OR IGNORE",
+		transient:    sqliteTransient,
+	}, nil
+}
+
+// sqliteTransient reports a database locked by another connection
+func sqliteTransient(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
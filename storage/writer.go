@@ -0,0 +1,129 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// writeRetries is how often a batch is written before giving up
+const writeRetries = 5
+
+// writeBackoff is the wait before the first retry, it doubles with every retry
+var writeBackoff = 500 * time.Millisecond
+
+// Writer saves observations, checkpoints and attempts in batches, every batch is one transaction.
+// A Writer is not safe for concurrent use.
+type Writer struct {
+	store       Store
+	batch       int
+	buffer      []Observation
+	checkpoints []Checkpoint
+	attempts    []Attempt
+}
+
+// NewWriter returns a writer that commits every batch observations, checkpoints and attempts.
+func NewWriter(store Store, batch int) *Writer {
+	if batch < 1 {
+		batch = 1
+	}
+	return &Writer{store: store, batch: batch}
+}
+
+// Write buffers an observation and writes the batch once it is full.
+func (w *Writer) Write(o Observation) error {
+	w.buffer = append(w.buffer, o)
+	if w.Buffered() < w.batch {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Checkpoint buffers a checkpoint of a query without observation.
+func (w *Writer) Checkpoint(c Checkpoint) error {
+	w.checkpoints = append(w.checkpoints, c)
+	if w.Buffered() < w.batch {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Attempt buffers a query sent to a server.
+func (w *Writer) Attempt(a Attempt) error {
+	w.attempts = append(w.attempts, a)
+	if w.Buffered() < w.batch {
+		return nil
+	}
+	return w.Flush()
+}
+
+// Flush writes everything buffered in one transaction.
+// Transient errors are retried with exponential backoff. On error the
+// rows stay buffered.
+func (w *Writer) Flush() error {
+	if w.Buffered() == 0 {
+		return nil
+	}
+	backoff := writeBackoff
+	for retry := 0; ; retry++ {
+		err := w.write()
+		if err == nil {
+			w.buffer = w.buffer[:0]
+			w.checkpoints = w.checkpoints[:0]
+			w.attempts = w.attempts[:0]
+			return nil
+		}
+		if retry == writeRetries || !w.store.Transient(err) {
+			return fmt.Errorf("could not write %d rows %w", w.Buffered(), err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Buffered returns the number of observations, checkpoints and attempts not written yet.
+func (w *Writer) Buffered() int {
+	return len(w.buffer) + len(w.checkpoints) + len(w.attempts)
+}
+
+// write saves the buffer in one transaction
+func (w *Writer) write() error {
+	tx, err := w.store.Begin()
+	if err != nil {
+		return err
+	}
+	for _, o := range w.buffer {
+		if err := tx.Insert(o); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, c := range w.checkpoints {
+		if err := tx.Checkpoint(c); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	for _, a := range w.attempts {
+		if err := tx.Attempt(a); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,307 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+
+// Package tldclass classifies TLD by attributes like ccTLD or gTLD, the IANA
+// type, the sponsoring organisation or the backend operator.
+//
+// Attributes are loaded from a CSV export of the IANA root zone database
+// (https://www.iana.org/domains/root/db) with a header line naming the columns
+//
+//	domain,type,sponsor,operator
+//	.com,generic,VeriSign Global Registry Services,VeriSign Global Registry Services
+//	.xn--p1ai,country-code,Coordination Center for TLD RU,Coordination Center for TLD RU
+//
+// and from lists with one TLD per line like those made by gettldlists.sh.
+package tldclass
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// attributes of every TLD
+const (
+	AttrTLD      = "tld"      // the TLD itself
+	AttrClass    = "class"    // cc or g
+	AttrType     = "type"     // IANA type: country-code, generic, sponsored, infrastructure, generic-restricted or test
+	AttrSponsor  = "sponsor"  // sponsoring organisation
+	AttrOperator = "operator" // backend operator
+)
+
+// values of the class attribute
+const (
+	ClassCC = "cc"
+	ClassG  = "g"
+)
+
+// TypeCountryCode is the IANA type of ccTLD, including IDN ccTLD
+const TypeCountryCode = "country-code"
+
+// Unknown is the value of attributes not known for a TLD
+const Unknown = "-"
+
+// column names of the root zone database export, the names of the IANA web page are accepted too
+var rootDBColumns = map[string]string{
+	"domain":                    AttrTLD,
+	"tld":                       AttrTLD,
+	"type":                      AttrType,
+	"sponsor":                   AttrSponsor,
+	"sponsoring organisation":   AttrSponsor,
+	"sponsoring organization":   AttrSponsor,
+	"tld manager":               AttrSponsor,
+	"operator":                  AttrOperator,
+	"backend operator":          AttrOperator,
+	"registry service provider": AttrOperator,
+}
+
+// Registry holds the attributes of all TLD
+type Registry struct {
+	values     map[string]map[string]string // TLD -> attribute -> value
+	attributes map[string]bool              // attributes loaded from lists
+}
+
+// New returns an empty registry, all TLD are classified by their name only
+func New() *Registry {
+	return &Registry{
+		values:     make(map[string]map[string]string, 0),
+		attributes: make(map[string]bool, 0),
+	}
+}
+
+// Normalize returns the TLD as lower case FQDN with the trailing dot,
+// e.g. XN--P1AI and .xn--p1ai both become "xn--p1ai.".
+func Normalize(tld string) string {
+	tld = strings.ToLower(strings.Trim(strings.TrimSpace(tld), "."))
+	if tld == "" {
+		return ""
+	}
+	return tld + "."
+}
+
+// set saves one attribute of a TLD
+func (r *Registry) set(tld string, attribute string, value string) {
+	if _, ok := r.values[tld]; !ok {
+		r.values[tld] = make(map[string]string, 0)
+	}
+	r.values[tld][attribute] = value
+}
+
+// LoadRootDB reads a CSV export of the IANA root zone database.
+// The first line names the columns, domain and type are required.
+func (r *Registry) LoadRootDB(filename string) error {
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	reader := csv.NewReader(fh)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("%s: no header %s", filename, err)
+	}
+	var columns map[int]string = make(map[int]string, 0)
+	var found map[string]bool = make(map[string]bool, 0)
+	for i, name := range header {
+		if attribute, ok := rootDBColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			columns[i] = attribute
+			found[attribute] = true
+		}
+	}
+	if !found[AttrTLD] || !found[AttrType] {
+		return fmt.Errorf("%s: header must name the columns domain and type", filename)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		var tld string
+		var attributes map[string]string = make(map[string]string, 0)
+		for i, field := range record {
+			attribute, ok := columns[i]
+			if !ok {
+				continue
+			}
+			field = strings.TrimSpace(field)
+			if attribute == AttrTLD {
+				tld = Normalize(field)
+				continue
+			}
+			if attribute == AttrType {
+				field = strings.ToLower(field)
+			}
+			if field != "" {
+				attributes[attribute] = field
+			}
+		}
+		if tld == "" {
+			continue
+		}
+		if !isASCII(tld) {
+			return fmt.Errorf("%s: %s must be written as A-label (xn--)", filename, tld)
+		}
+		for attribute, value := range attributes {
+			r.set(tld, attribute, value)
+		}
+	}
+	return nil
+}
+
+// LoadList reads a list of TLD, one per line, and sets attribute for every TLD in it.
+// A line may give the value after the TLD, otherwise the value is the name of
+// the file without extension, e.g. cctlds for cctlds.txt.
+// Empty lines and lines starting with # are skipped.
+func (r *Registry) LoadList(attribute string, filename string) error {
+	attribute = strings.ToLower(strings.TrimSpace(attribute))
+	if attribute == "" {
+		return fmt.Errorf("%s: no attribute given", filename)
+	}
+	switch attribute {
+	case AttrTLD, AttrClass:
+		return fmt.Errorf("%s: attribute %s can not be set by a list", filename, attribute)
+	}
+
+	fh, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	value := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	r.attributes[attribute] = true
+
+	scanner := bufio.NewScanner(fh)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		tld := Normalize(fields[0])
+		if !isASCII(tld) {
+			return fmt.Errorf("%s line %d: %s must be written as A-label (xn--)", filename, line, fields[0])
+		}
+		v := value
+		if len(fields) > 1 {
+			v = strings.Join(fields[1:], " ")
+		}
+		r.set(tld, attribute, v)
+	}
+	return scanner.Err()
+}
+
+// Attributes returns the names of all attributes a TLD can be classified by
+func (r *Registry) Attributes() []string {
+	attributes := []string{AttrTLD, AttrClass, AttrType, AttrSponsor, AttrOperator}
+	var lists []string
+	for attribute := range r.attributes {
+		switch attribute {
+		case AttrType, AttrSponsor, AttrOperator:
+		default:
+			lists = append(lists, attribute)
+		}
+	}
+	sort.Strings(lists)
+	return append(attributes, lists...)
+}
+
+// HasAttribute reports if TLD can be classified by attribute
+func (r *Registry) HasAttribute(attribute string) bool {
+	for _, a := range r.Attributes() {
+		if a == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// Value returns the value of attribute for a TLD, Unknown if it is not known
+func (r *Registry) Value(tld string, attribute string) string {
+	tld = Normalize(tld)
+	switch attribute {
+	case AttrTLD:
+		return tld
+	case AttrClass:
+		return r.Class(tld)
+	}
+	if value, ok := r.values[tld][attribute]; ok {
+		return value
+	}
+	return Unknown
+}
+
+// Class returns cc for ccTLD and g for all other TLD.
+// TLD in the root zone database are classified by their type, all others by
+// their name: two letters are a ccTLD, IDN ccTLD are only known from the database.
+func (r *Registry) Class(tld string) string {
+	tld = Normalize(tld)
+	if t, ok := r.values[tld][AttrType]; ok {
+		if t == TypeCountryCode {
+			return ClassCC
+		}
+		return ClassG
+	}
+	if len(tld) == 3 && isLetter(tld[0]) && isLetter(tld[1]) {
+		return ClassCC
+	}
+	return ClassG
+}
+
+// Values returns the sorted values of attribute for a list of TLD.
+// The class attribute always has both values, so reports keep their columns.
+func (r *Registry) Values(attribute string, tlds []string) []string {
+	var seen map[string]bool = make(map[string]bool, 0)
+	if attribute == AttrClass {
+		seen[ClassCC] = true
+		seen[ClassG] = true
+	}
+	for _, tld := range tlds {
+		seen[r.Value(tld, attribute)] = true
+	}
+	var values []string
+	for value := range seen {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+/*
+Copyright © 2023 Ulrich Wisser <ulrich@wisser.se>
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package tldclass
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testRootDB = `Domain,Type,TLD Manager
+.com,generic,VeriSign Global Registry Services
+.se,country-code,The Internet Infrastructure Foundation
+.xn--p1ai,country-code,Coordination Center for TLD RU
+.arpa,infrastructure,Internet Architecture Board (IAB)
+.museum,sponsored,Museum Domain Management Association
+`
+
+const testList = `# backend operators
+com verisign
+SE.
+
+.xn--p1ai
+`
+
+// writeFile saves a fixture in a temporary directory
+func writeFile(t *testing.T, name string, data string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// testRegistry returns a registry loaded with the root zone database and the list
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r := New()
+	if err := r.LoadRootDB(writeFile(t, "root.csv", testRootDB)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadList("backend", writeFile(t, "nordic.txt", testList)); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"se":        "se.",
+		".SE":       "se.",
+		" se. ":     "se.",
+		"XN--P1AI":  "xn--p1ai.",
+		".xn--p1ai": "xn--p1ai.",
+		"":          "",
+		".":         "",
+		"co.uk":     "co.uk.",
+	}
+	for tld, want := range tests {
+		if got := Normalize(tld); got != want {
+			t.Errorf("Normalize(%q): got %q, want %q", tld, got, want)
+		}
+	}
+}
+
+func TestClass(t *testing.T) {
+	r := testRegistry(t)
+	tests := []struct {
+		tld  string
+		want string
+	}{
+		{"com.", ClassG},
+		{"se.", ClassCC},
+		{"xn--p1ai.", ClassCC}, // IDN ccTLD, only known from the database
+		{"arpa.", ClassG},
+		{"museum.", ClassG},
+		{"nu.", ClassCC},      // in neither, two letters
+		{"org.", ClassG},      // in neither, three letters
+		{"xn--90ae.", ClassG}, // IDN ccTLD missing from the database
+		{"NU", ClassCC},       // not normalized
+	}
+	for _, test := range tests {
+		if got := r.Class(test.tld); got != test.want {
+			t.Errorf("Class(%s): got %s, want %s", test.tld, got, test.want)
+		}
+		if got := r.Value(test.tld, AttrClass); got != test.want {
+			t.Errorf("Value(%s, class): got %s, want %s", test.tld, got, test.want)
+		}
+	}
+
+	// without database all TLD are classified by name
+	if got := New().Class("com."); got != ClassG {
+		t.Errorf("empty registry: com. is %s", got)
+	}
+	if got := New().Class("se."); got != ClassCC {
+		t.Errorf("empty registry: se. is %s", got)
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := testRegistry(t)
+	tests := []struct {
+		tld       string
+		attribute string
+		want      string
+	}{
+		{"se.", AttrTLD, "se."},
+		{".SE", AttrTLD, "se."},
+		{"se.", AttrType, TypeCountryCode},
+		{"arpa.", AttrType, "infrastructure"},
+		{"se.", AttrSponsor, "The Internet Infrastructure Foundation"},
+		{"se.", AttrOperator, Unknown}, // no operator column
+		{"com.", "backend", "verisign"},
+		{"se.", "backend", "nordic"},
+		{"xn--p1ai.", "backend", "nordic"},
+		{"museum.", "backend", Unknown},
+		{"nu.", AttrType, Unknown},
+		{"nu.", "backend", Unknown},
+	}
+	for _, test := range tests {
+		if got := r.Value(test.tld, test.attribute); got != test.want {
+			t.Errorf("Value(%s, %s): got %q, want %q", test.tld, test.attribute, got, test.want)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	r := testRegistry(t)
+	want := []string{AttrTLD, AttrClass, AttrType, AttrSponsor, AttrOperator, "backend"}
+	if got := r.Attributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !r.HasAttribute("backend") || r.HasAttribute("unknown") {
+		t.Errorf("HasAttribute is wrong for %v", r.Attributes())
+	}
+}
+
+func TestValues(t *testing.T) {
+	r := testRegistry(t)
+	tlds := []string{"com.", "se.", "nu."}
+	if got, want := r.Values(AttrClass, []string{"com."}), []string{ClassCC, ClassG}; !reflect.DeepEqual(got, want) {
+		t.Errorf("class: got %v, want %v", got, want)
+	}
+	if got, want := r.Values("backend", tlds), []string{Unknown, "nordic", "verisign"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("backend: got %v, want %v", got, want)
+	}
+	if got, want := r.Values(AttrType, tlds), []string{Unknown, TypeCountryCode, "generic"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("type: got %v, want %v", got, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		load func(r *Registry, dir string) error
+	}{
+		{"missing file", func(r *Registry, dir string) error { return r.LoadRootDB(filepath.Join(dir, "missing.csv")) }},
+		{"no type column", func(r *Registry, dir string) error {
+			return r.LoadRootDB(writeFile(t, "root.csv", "Domain,TLD Manager\n.se,IIS\n"))
+		}},
+		{"U-label in database", func(r *Registry, dir string) error {
+			return r.LoadRootDB(writeFile(t, "root.csv", "Domain,Type\n.рф,country-code\n"))
+		}},
+		{"U-label in list", func(r *Registry, dir string) error {
+			return r.LoadList("backend", writeFile(t, "list.txt", "рф\n"))
+		}},
+		{"list of class", func(r *Registry, dir string) error {
+			return r.LoadList(AttrClass, writeFile(t, "list.txt", "se\n"))
+		}},
+		{"list without attribute", func(r *Registry, dir string) error {
+			return r.LoadList(" ", writeFile(t, "list.txt", "se\n"))
+		}},
+	}
+	for _, test := range tests {
+		if err := test.load(New(), t.TempDir()); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}